@@ -0,0 +1,464 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/openstack-exporter/openstack-exporter/exporters"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the content of the exporter configuration file. The settings of
+// a cloud entry take precedence over the top level ones, and the settings of
+// a service over the ones of the cloud or top level it belongs to.
+type Config struct {
+	// Cloud is the cloud whose metrics are served on the metrics path.
+	Cloud            string                   `yaml:"cloud"`
+	Prefix           string                   `yaml:"prefix"`
+	EndpointType     string                   `yaml:"endpoint_type"`
+	Regions          []string                 `yaml:"regions"`
+	RefreshInterval  time.Duration            `yaml:"refresh_interval"`
+	Timeout          time.Duration            `yaml:"timeout"`
+	DisabledMetrics  []string                 `yaml:"disabled_metrics"`
+	EnabledMetrics   []string                 `yaml:"enabled_metrics"`
+	DiscoverServices bool                     `yaml:"discover_services"`
+	MaxSeries        SeriesLimitsConfig       `yaml:"max_series"`
+	Services         map[string]ServiceConfig `yaml:"services"`
+	Clouds           map[string]CloudConfig   `yaml:"clouds"`
+
+	// clouds loads the entries of the clouds from clouds.yaml.
+	clouds exporters.CloudsYAML
+}
+
+// CloudConfig holds the settings specific to one cloud of clouds.yaml.
+type CloudConfig struct {
+	EndpointType     string                   `yaml:"endpoint_type"`
+	Regions          []string                 `yaml:"regions"`
+	DiscoverServices *bool                    `yaml:"discover_services"`
+	Services         map[string]ServiceConfig `yaml:"services"`
+}
+
+// ServiceConfig holds the settings of one service exporter.
+type ServiceConfig struct {
+	Enabled         *bool         `yaml:"enabled"`
+	EndpointType    string        `yaml:"endpoint_type"`
+	Endpoint        string        `yaml:"endpoint"`
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	Timeout         time.Duration `yaml:"timeout"`
+	// Microversion pins the API microversion of the compute, volume and
+	// load-balancer services, or latest to negotiate it.
+	Microversion string `yaml:"microversion"`
+	// MaxSeries overrides the series limits of the exporter.
+	MaxSeries SeriesLimitsConfig `yaml:"max_series"`
+	// DisabledMetrics and EnabledMetrics are patterns of the metrics of the
+	// service, without the service part (i.e: server_diagnostics_*).
+	DisabledMetrics []string `yaml:"disabled_metrics"`
+	EnabledMetrics  []string `yaml:"enabled_metrics"`
+}
+
+// SeriesLimitsConfig caps the number of series sent by a collection of an
+// exporter, zero doesn't cap them.
+type SeriesLimitsConfig struct {
+	PerMetric  int `yaml:"per_metric"`
+	PerService int `yaml:"per_service"`
+}
+
+func (limits SeriesLimitsConfig) validate() error {
+	if limits.PerMetric < 0 || limits.PerService < 0 {
+		return fmt.Errorf("max_series must not be negative")
+	}
+	return nil
+}
+
+var validEndpointTypes = []string{"public", "internal", "admin", "publicURL", "internalURL", "adminURL"}
+
+// loadConfig reads and validates the configuration file at path.
+func loadConfig(path string) (*Config, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(content, config); err != nil {
+		return nil, fmt.Errorf("parsing %s failed: %s", path, err)
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration in %s: %s", path, err)
+	}
+	return config, nil
+}
+
+func (config *Config) validate() error {
+	if err := validateEndpointType(config.EndpointType); err != nil {
+		return err
+	}
+	if err := validateRegions(config.Regions); err != nil {
+		return err
+	}
+	if config.RefreshInterval < 0 {
+		return fmt.Errorf("refresh_interval must not be negative")
+	}
+	if config.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	if err := config.MaxSeries.validate(); err != nil {
+		return err
+	}
+	if err := exporters.ValidateMetricPatterns(config.DisabledMetrics); err != nil {
+		return err
+	}
+	if err := exporters.ValidateMetricPatterns(config.EnabledMetrics); err != nil {
+		return err
+	}
+	if err := validateServices(config.Services); err != nil {
+		return err
+	}
+
+	for name, cloud := range config.Clouds {
+		if err := validateEndpointType(cloud.EndpointType); err != nil {
+			return fmt.Errorf("cloud %s: %s", name, err)
+		}
+		if err := validateRegions(cloud.Regions); err != nil {
+			return fmt.Errorf("cloud %s: %s", name, err)
+		}
+		if err := validateServices(cloud.Services); err != nil {
+			return fmt.Errorf("cloud %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func validateEndpointType(endpointType string) error {
+	if endpointType == "" {
+		return nil
+	}
+	for _, valid := range validEndpointTypes {
+		if endpointType == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown endpoint_type %q, must be one of %v", endpointType, validEndpointTypes)
+}
+
+func validateEndpoint(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid endpoint %q, must be an http or https URL", endpoint)
+	}
+	return nil
+}
+
+func validateRegions(regions []string) error {
+	for _, region := range regions {
+		if region == "" {
+			return fmt.Errorf("regions must not contain empty names")
+		}
+	}
+	return nil
+}
+
+func validateServices(services map[string]ServiceConfig) error {
+	for name, service := range services {
+		if !isKnownService(name) {
+			return fmt.Errorf("unknown service %q, must be one of %v", name, exporters.DefaultRegistry.Types())
+		}
+		if err := validateEndpointType(service.EndpointType); err != nil {
+			return fmt.Errorf("service %s: %s", name, err)
+		}
+		if err := validateEndpoint(service.Endpoint); err != nil {
+			return fmt.Errorf("service %s: %s", name, err)
+		}
+		if service.RefreshInterval < 0 {
+			return fmt.Errorf("service %s: refresh_interval must not be negative", name)
+		}
+		if service.Timeout < 0 {
+			return fmt.Errorf("service %s: timeout must not be negative", name)
+		}
+		if err := service.MaxSeries.validate(); err != nil {
+			return fmt.Errorf("service %s: %s", name, err)
+		}
+		if err := exporters.ValidateMicroversion(name, service.Microversion); err != nil {
+			return fmt.Errorf("service %s: %s", name, err)
+		}
+		if err := exporters.ValidateMetricPatterns(service.DisabledMetrics); err != nil {
+			return fmt.Errorf("service %s: %s", name, err)
+		}
+		if err := exporters.ValidateMetricPatterns(service.EnabledMetrics); err != nil {
+			return fmt.Errorf("service %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func isKnownService(name string) bool {
+	_, err := exporters.DefaultRegistry.Service(name)
+	return err == nil
+}
+
+// service returns the settings of service on cloud, the ones of the cloud
+// entry taking precedence over the top level ones.
+func (config *Config) service(cloud, service string) ServiceConfig {
+	merged := config.Services[service]
+	override := config.Clouds[cloud].Services[service]
+
+	if override.Enabled != nil {
+		merged.Enabled = override.Enabled
+	}
+	if override.EndpointType != "" {
+		merged.EndpointType = override.EndpointType
+	}
+	if override.Endpoint != "" {
+		merged.Endpoint = override.Endpoint
+	}
+	if override.RefreshInterval != 0 {
+		merged.RefreshInterval = override.RefreshInterval
+	}
+	if override.Timeout != 0 {
+		merged.Timeout = override.Timeout
+	}
+	if override.Microversion != "" {
+		merged.Microversion = override.Microversion
+	}
+	if override.MaxSeries.PerMetric != 0 {
+		merged.MaxSeries.PerMetric = override.MaxSeries.PerMetric
+	}
+	if override.MaxSeries.PerService != 0 {
+		merged.MaxSeries.PerService = override.MaxSeries.PerService
+	}
+	merged.DisabledMetrics = append(append([]string{}, merged.DisabledMetrics...), override.DisabledMetrics...)
+	if len(override.EnabledMetrics) > 0 {
+		merged.EnabledMetrics = override.EnabledMetrics
+	}
+	return merged
+}
+
+// enabledServices returns the services enabled on cloud, the registered ones
+// being enabled unless disabled or not enabled by default.
+func (config *Config) enabledServices(cloud string) []string {
+	var enabled []string
+	for _, name := range exporters.DefaultRegistry.Types() {
+		service, _ := exporters.DefaultRegistry.Service(name)
+		if settings := config.service(cloud, name); settings.Enabled != nil {
+			service.DefaultEnabled = *settings.Enabled
+		}
+		if service.DefaultEnabled {
+			enabled = append(enabled, name)
+		}
+	}
+	return enabled
+}
+
+// discoverServices tells whether the services of cloud are discovered from
+// its service catalog.
+func (config *Config) discoverServices(cloud string) bool {
+	if discover := config.Clouds[cloud].DiscoverServices; discover != nil {
+		return *discover
+	}
+	return config.DiscoverServices
+}
+
+// regions returns the regions to collect on cloud, none meaning the region of
+// the cloud entry in clouds.yaml.
+func (config *Config) regions(cloud string) []string {
+	if regions := config.Clouds[cloud].Regions; len(regions) > 0 {
+		return regions
+	}
+	return config.Regions
+}
+
+// exporterConfig returns the endpoint type and the configuration of the
+// exporter of service on cloud, built on top of base.
+func (config *Config) exporterConfig(cloud, service string, base exporters.ExporterConfig) (string, exporters.ExporterConfig) {
+	settings := config.service(cloud, service)
+	endpointType := config.endpointType(cloud, service)
+
+	base.Prefix = config.Prefix
+	base.RefreshInterval = config.RefreshInterval
+	if settings.RefreshInterval != 0 {
+		base.RefreshInterval = settings.RefreshInterval
+	}
+	base.Timeout = config.Timeout
+	if settings.Timeout != 0 {
+		base.Timeout = settings.Timeout
+	}
+	base.Microversion = settings.Microversion
+	base.MaxSeries = exporters.SeriesLimits{PerMetric: config.MaxSeries.PerMetric, PerService: config.MaxSeries.PerService}
+	if settings.MaxSeries.PerMetric != 0 {
+		base.MaxSeries.PerMetric = settings.MaxSeries.PerMetric
+	}
+	if settings.MaxSeries.PerService != 0 {
+		base.MaxSeries.PerService = settings.MaxSeries.PerService
+	}
+	base.Endpoint = settings.Endpoint
+	// The projects are listed from the identity service, at its own endpoint.
+	base.IdentityEndpointType = config.endpointType(cloud, "identity")
+	base.IdentityEndpoint = config.service(cloud, "identity").Endpoint
+
+	// The metric patterns of a service only apply to its own metrics, and its
+	// enabled metrics replace the top level ones.
+	name, _ := exporters.ExporterName(service)
+	base.DisabledMetrics = append([]string{}, config.DisabledMetrics...)
+	for _, pattern := range settings.DisabledMetrics {
+		base.DisabledMetrics = append(base.DisabledMetrics, exporters.ServiceMetricPattern(name, pattern))
+	}
+	base.EnabledMetrics = config.EnabledMetrics
+	if len(settings.EnabledMetrics) > 0 {
+		base.EnabledMetrics = nil
+		for _, pattern := range settings.EnabledMetrics {
+			base.EnabledMetrics = append(base.EnabledMetrics, exporters.ServiceMetricPattern(name, pattern))
+		}
+	}
+	return endpointType, base
+}
+
+// endpointType returns the endpoint type of service on cloud.
+func (config *Config) endpointType(cloud, service string) string {
+	endpointType := config.EndpointType
+	if v := config.Clouds[cloud].EndpointType; v != "" {
+		endpointType = v
+	}
+	if v := config.service(cloud, service).EndpointType; v != "" {
+		endpointType = v
+	}
+	return endpointType
+}
+
+// cloudEntry returns the entry of cloud in clouds.yaml, whose region defaults
+// to the one of the environment.
+func (config *Config) cloudEntry(cloud string) (*clientconfig.Cloud, error) {
+	entry, err := config.clouds.Cloud(cloud)
+	if err != nil {
+		return nil, err
+	}
+	if entry.RegionName == "" {
+		entry.RegionName = os.Getenv("OS_REGION_NAME")
+	}
+	return entry, nil
+}
+
+// exporterOptions returns the options of the exporter of service in region of
+// cloud, the region of the cloud entry when empty.
+func (config *Config) exporterOptions(cloud, service, region string, base exporters.ExporterConfig) (exporters.Options, error) {
+	entry, err := config.cloudEntry(cloud)
+	if err != nil {
+		return exporters.Options{}, err
+	}
+	endpointType, exporterConfig := config.exporterConfig(cloud, service, base)
+	exporterConfig.Region = region
+	return exporters.Options{
+		ExporterConfig: exporterConfig,
+		Service:        service,
+		Cloud:          cloud,
+		CloudConfig:    entry,
+		EndpointType:   endpointType,
+	}, nil
+}
+
+func (config *Config) overrideEndpointType(endpointType string, everywhere bool) {
+	config.EndpointType = endpointType
+	if !everywhere {
+		return
+	}
+	config.updateServices(func(service *ServiceConfig) { service.EndpointType = "" })
+	for name, cloud := range config.Clouds {
+		cloud.EndpointType = ""
+		config.Clouds[name] = cloud
+	}
+}
+
+func (config *Config) overrideRefreshInterval(interval time.Duration) {
+	config.RefreshInterval = interval
+	config.updateServices(func(service *ServiceConfig) { service.RefreshInterval = 0 })
+}
+
+func (config *Config) overrideTimeout(timeout time.Duration) {
+	config.Timeout = timeout
+	config.updateServices(func(service *ServiceConfig) { service.Timeout = 0 })
+}
+
+func (config *Config) overrideMaxSeriesPerMetric(limit int) {
+	config.MaxSeries.PerMetric = limit
+	config.updateServices(func(service *ServiceConfig) { service.MaxSeries.PerMetric = 0 })
+}
+
+func (config *Config) overrideMaxSeriesPerService(limit int) {
+	config.MaxSeries.PerService = limit
+	config.updateServices(func(service *ServiceConfig) { service.MaxSeries.PerService = 0 })
+}
+
+func (config *Config) overrideRegions(regions []string) {
+	config.Regions = regions
+	for name, cloud := range config.Clouds {
+		cloud.Regions = nil
+		config.Clouds[name] = cloud
+	}
+}
+
+func (config *Config) overrideDiscoverServices(discover bool) {
+	config.DiscoverServices = discover
+	for name, cloud := range config.Clouds {
+		cloud.DiscoverServices = nil
+		config.Clouds[name] = cloud
+	}
+}
+
+func (config *Config) overrideEnabledMetrics(patterns []string) {
+	config.EnabledMetrics = patterns
+	config.updateServices(func(service *ServiceConfig) { service.EnabledMetrics = nil })
+}
+
+func (config *Config) overrideServiceTimeout(name string, timeout time.Duration) {
+	config.updateService(name, func(service *ServiceConfig) { service.Timeout = timeout })
+}
+
+func (config *Config) overrideServiceEndpointType(name, endpointType string) {
+	config.updateService(name, func(service *ServiceConfig) { service.EndpointType = endpointType })
+}
+
+func (config *Config) overrideServiceEndpoint(name, endpoint string) {
+	config.updateService(name, func(service *ServiceConfig) { service.Endpoint = endpoint })
+}
+
+func (config *Config) overrideMicroversion(name, microversion string) {
+	config.updateService(name, func(service *ServiceConfig) { service.Microversion = microversion })
+}
+
+func (config *Config) disableService(name string) {
+	disabled := false
+	config.updateService(name, func(service *ServiceConfig) { service.Enabled = &disabled })
+}
+
+// updateServices applies update to the settings of every service, at the top
+// level and in every cloud.
+func (config *Config) updateServices(update func(service *ServiceConfig)) {
+	for _, name := range exporters.DefaultRegistry.Types() {
+		config.updateService(name, update)
+	}
+}
+
+// updateService applies update to the settings of the service, at the top
+// level and in every cloud.
+func (config *Config) updateService(name string, update func(service *ServiceConfig)) {
+	if config.Services == nil {
+		config.Services = make(map[string]ServiceConfig)
+	}
+	service := config.Services[name]
+	update(&service)
+	config.Services[name] = service
+
+	for _, cloud := range config.Clouds {
+		if service, ok := cloud.Services[name]; ok {
+			update(&service)
+			cloud.Services[name] = service
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openstack-exporter/openstack-exporter/exporters"
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `
+prefix: os
+endpoint_type: internal
+timeout: 30s
+regions: [RegionOne]
+max_series: {per_metric: 1000}
+services:
+  compute:
+    timeout: 1m
+    max_series: {per_service: 5000}
+    microversion: "2.60"
+    endpoint: https://nova.example.com:8774/v2.1
+    disabled_metrics: [limits_vcpus_max]
+    enabled_metrics: ["limits_*"]
+  identity:
+    endpoint_type: admin
+    endpoint: https://keystone.example.com:5000/v3
+  object-store:
+    enabled: false
+clouds:
+  other:
+    endpoint_type: public
+    regions: [all]
+    discover_services: true
+    services:
+      object-store:
+        enabled: true
+`
+
+func writeConfig(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "config")
+	assert.NoError(t, err)
+	_, err = file.WriteString(content)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+	return file.Name()
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, testConfig)
+	defer os.Remove(path)
+
+	config, err := loadConfig(path)
+	assert.NoError(t, err)
+
+	assert.NotContains(t, config.enabledServices("mycloud"), "object-store")
+	assert.Contains(t, config.enabledServices("other"), "object-store")
+	assert.Equal(t, []string{"RegionOne"}, config.regions("mycloud"))
+	assert.Equal(t, []string{"all"}, config.regions("other"))
+	assert.False(t, config.discoverServices("mycloud"))
+	assert.True(t, config.discoverServices("other"))
+
+	endpointType, exporterConfig := config.exporterConfig("mycloud", "compute", exporters.ExporterConfig{})
+	assert.Equal(t, "internal", endpointType)
+	assert.Equal(t, "os", exporterConfig.Prefix)
+	assert.Equal(t, time.Minute, exporterConfig.Timeout)
+	assert.Equal(t, "2.60", exporterConfig.Microversion)
+	assert.Equal(t, "https://nova.example.com:8774/v2.1", exporterConfig.Endpoint)
+	assert.Equal(t, "admin", exporterConfig.IdentityEndpointType)
+	assert.Equal(t, "https://keystone.example.com:5000/v3", exporterConfig.IdentityEndpoint)
+	assert.Equal(t, []string{"nova-limits_vcpus_max"}, exporterConfig.DisabledMetrics)
+	assert.Equal(t, []string{"nova-limits_*"}, exporterConfig.EnabledMetrics)
+	assert.Equal(t, exporters.SeriesLimits{PerMetric: 1000, PerService: 5000}, exporterConfig.MaxSeries)
+
+	endpointType, exporterConfig = config.exporterConfig("other", "image", exporters.ExporterConfig{})
+	assert.Equal(t, "public", endpointType)
+	assert.Equal(t, 30*time.Second, exporterConfig.Timeout)
+	assert.Empty(t, exporterConfig.EnabledMetrics)
+	assert.Equal(t, exporters.SeriesLimits{PerMetric: 1000}, exporterConfig.MaxSeries)
+}
+
+func TestConfigOverrides(t *testing.T) {
+	path := writeConfig(t, testConfig)
+	defer os.Remove(path)
+
+	config, err := loadConfig(path)
+	assert.NoError(t, err)
+
+	config.overrideEndpointType("admin", true)
+	config.overrideServiceTimeout("compute", 5*time.Second)
+	config.disableService("object-store")
+	config.overrideDiscoverServices(false)
+	config.overrideServiceEndpointType("image", "internal")
+	config.overrideMaxSeriesPerService(100)
+
+	endpointType, exporterConfig := config.exporterConfig("other", "compute", exporters.ExporterConfig{})
+	assert.Equal(t, "admin", endpointType)
+	assert.Equal(t, 5*time.Second, exporterConfig.Timeout)
+	assert.NotContains(t, config.enabledServices("other"), "object-store")
+	assert.False(t, config.discoverServices("other"))
+	assert.Equal(t, exporters.SeriesLimits{PerMetric: 1000, PerService: 100}, exporterConfig.MaxSeries)
+
+	endpointType, _ = config.exporterConfig("other", "image", exporters.ExporterConfig{})
+	assert.Equal(t, "internal", endpointType)
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for content, message := range map[string]string{
+		"endpoint_type: private":                   `unknown endpoint_type "private"`,
+		"services: {dns: {}}":                      `unknown service "dns"`,
+		"clouds: {a: {regions: ['']}}":             "cloud a: regions must not contain empty names",
+		"services: {compute: {timeout: -1s}}":      "service compute: timeout must not be negative",
+		"refresh: 1m":                              "field refresh not found",
+		"services: {image: {microversion: '2.1'}}": "service image: the image service has no microversion",
+		"enabled_metrics: ['nova-[']":              `invalid metric pattern "nova-["`,
+		"max_series: {per_metric: -1}":             "max_series must not be negative",
+		"services: {image: {endpoint: ftp://x}}":   `service image: invalid endpoint "ftp://x"`,
+	} {
+		path := writeConfig(t, content)
+		_, err := loadConfig(path)
+		os.Remove(path)
+		if assert.Error(t, err, content) {
+			assert.Contains(t, err.Error(), message)
+		}
+	}
+}
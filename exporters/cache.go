@@ -0,0 +1,97 @@
+package exporters
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+// scrapeCache keeps the API collections fetched during one scrape, so that the
+// ListFuncs needing the same collection fetch it only once.
+type scrapeCache struct {
+	sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+	// abandoned is set when the fetch failed because its context was done.
+	abandoned bool
+}
+
+type cacheKey struct{}
+
+// WithCache returns a copy of ctx carrying a new scrape cache. The exporters
+// collected with the returned context share the API collections they fetch,
+// which must therefore all belong to the same cloud. A collection without a
+// cache in its context uses one of its own.
+func WithCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheKey{}, &scrapeCache{entries: make(map[string]*cacheEntry)})
+}
+
+func hasCache(ctx context.Context) bool {
+	_, ok := ctx.Value(cacheKey{}).(*scrapeCache)
+	return ok
+}
+
+// cached returns the collection of the resource listed by client, calling fetch
+// the first time it is requested within the scrape of ctx. Concurrent requests
+// of the same collection wait for the first fetch, and fetch it again when it
+// failed because its own context was done.
+func cached(ctx context.Context, client *gophercloud.ServiceClient, resource string, fetch func() (interface{}, error)) (interface{}, error) {
+	cache, ok := ctx.Value(cacheKey{}).(*scrapeCache)
+	if !ok {
+		return fetch()
+	}
+
+	key := client.ResourceBaseURL() + resource
+
+	for {
+		cache.Lock()
+		entry, ok := cache.entries[key]
+		if !ok {
+			entry = &cacheEntry{done: make(chan struct{})}
+			cache.entries[key] = entry
+		}
+		cache.Unlock()
+
+		if !ok {
+			cache.fetch(ctx, key, entry, fetch)
+			return entry.value, entry.err
+		}
+
+		select {
+		case <-entry.done:
+			if entry.abandoned && ctx.Err() == nil {
+				continue
+			}
+			return entry.value, entry.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// fetch sets entry from fetch, a panic of fetch failing it, and releases the
+// requests waiting for it in any case. The exporters sharing the cache have
+// their own timeouts: an entry failed once ctx is done is abandoned, for the
+// waiting requests to fetch it again with their own context.
+func (cache *scrapeCache) fetch(ctx context.Context, key string, entry *cacheEntry, fetch func() (interface{}, error)) {
+	defer close(entry.done)
+	defer func() {
+		if r := recover(); r != nil {
+			entry.value, entry.err = nil, fmt.Errorf("panic: %v", r)
+		}
+		if entry.err != nil && ctx.Err() != nil {
+			entry.abandoned = true
+			cache.Lock()
+			delete(cache.entries, key)
+			cache.Unlock()
+		}
+	}()
+	entry.value, entry.err = fetch()
+}
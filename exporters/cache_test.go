@@ -0,0 +1,90 @@
+package exporters
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedFetchPanics(t *testing.T) {
+	ctx := WithCache(context.Background())
+	client := &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: "https://nova.example.com/v2.1/"}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	first := make(chan error, 1)
+	go func() {
+		_, err := cached(ctx, client, "servers", func() (interface{}, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+		first <- err
+	}()
+	<-started
+
+	second := make(chan error, 1)
+	go func() {
+		_, err := cached(ctx, client, "servers", func() (interface{}, error) {
+			return nil, errors.New("fetched twice")
+		})
+		second <- err
+	}()
+	close(release)
+
+	for _, result := range []chan error{first, second} {
+		select {
+		case err := <-result:
+			assert.EqualError(t, err, "panic: boom")
+		case <-time.After(time.Second):
+			t.Fatal("cached didn't return after the fetch panicked")
+		}
+	}
+}
+
+func TestCachedFetchCancelled(t *testing.T) {
+	ctx := WithCache(context.Background())
+	client := &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{}, Endpoint: "https://nova.example.com/v2.1/"}
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	started := make(chan struct{})
+	first := make(chan error, 1)
+	go func() {
+		_, err := cached(leaderCtx, client, "servers", func() (interface{}, error) {
+			close(started)
+			<-leaderCtx.Done()
+			return nil, leaderCtx.Err()
+		})
+		first <- err
+	}()
+	<-started
+
+	// The request waiting for the fetch cancelled with the context of the
+	// first one fetches the collection again.
+	second := make(chan interface{}, 1)
+	go func() {
+		value, err := cached(ctx, client, "servers", func() (interface{}, error) {
+			return "servers", nil
+		})
+		assert.NoError(t, err)
+		second <- value
+	}()
+	cancel()
+
+	select {
+	case err := <-first:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("cached didn't return after its context was cancelled")
+	}
+	select {
+	case value := <-second:
+		assert.Equal(t, "servers", value)
+	case <-time.After(time.Second):
+		t.Fatal("cached didn't fetch the collection again")
+	}
+}
@@ -0,0 +1,156 @@
+package exporters
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	tokens2 "github.com/gophercloud/gophercloud/openstack/identity/v2/tokens"
+	tokens3 "github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"github.com/gophercloud/utils/openstack/clientconfig"
+)
+
+// CatalogEndpoint is an endpoint of the service catalog of a cloud.
+type CatalogEndpoint struct {
+	ServiceType string
+	ServiceName string
+	Region      string
+	Interface   string
+}
+
+// Catalog is the service catalog of a cloud, as seen by its token.
+type Catalog struct {
+	Endpoints []CatalogEndpoint
+	// cloud is the cloud entry the token was obtained with, which tells the
+	// API versions and the default region of the exporters.
+	cloud *clientconfig.Cloud
+}
+
+// ServiceCatalog returns the service catalog of the cloud of options, read
+// from the token of its provider client, shared with the exporters when
+// Providers is set.
+func ServiceCatalog(options Options) (*Catalog, error) {
+	if options.CloudConfig == nil {
+		return nil, fmt.Errorf("no cloud entry given for the service catalog")
+	}
+
+	provider, err := providerClient(options)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints, err := catalogEndpoints(provider)
+	if err != nil {
+		return nil, err
+	}
+	return &Catalog{Endpoints: endpoints, cloud: options.CloudConfig}, nil
+}
+
+// catalogEndpoints returns the endpoints of the service catalog of the token
+// of client.
+func catalogEndpoints(client *gophercloud.ProviderClient) ([]CatalogEndpoint, error) {
+	var endpoints []CatalogEndpoint
+	switch result := client.GetAuthResult().(type) {
+	case tokens3.CreateResult:
+		catalog, err := result.ExtractServiceCatalog()
+		if err != nil {
+			return nil, err
+		}
+		endpoints = v3Endpoints(catalog)
+	case tokens3.GetResult:
+		catalog, err := result.ExtractServiceCatalog()
+		if err != nil {
+			return nil, err
+		}
+		endpoints = v3Endpoints(catalog)
+	case tokens2.CreateResult:
+		catalog, err := result.ExtractServiceCatalog()
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range catalog.Entries {
+			for _, endpoint := range entry.Endpoints {
+				for availability, url := range map[string]string{"public": endpoint.PublicURL, "internal": endpoint.InternalURL, "admin": endpoint.AdminURL} {
+					if url != "" {
+						endpoints = append(endpoints, CatalogEndpoint{ServiceType: entry.Type, ServiceName: entry.Name, Region: endpoint.Region, Interface: availability})
+					}
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("no service catalog in the authentication result")
+	}
+
+	sort.Slice(endpoints, func(i, j int) bool {
+		a, b := endpoints[i], endpoints[j]
+		if a.ServiceType != b.ServiceType {
+			return a.ServiceType < b.ServiceType
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		return a.Interface < b.Interface
+	})
+	return endpoints, nil
+}
+
+func v3Endpoints(catalog *tokens3.ServiceCatalog) []CatalogEndpoint {
+	var endpoints []CatalogEndpoint
+	for _, entry := range catalog.Entries {
+		for _, endpoint := range entry.Endpoints {
+			region := endpoint.RegionID
+			if region == "" {
+				region = endpoint.Region
+			}
+			endpoints = append(endpoints, CatalogEndpoint{ServiceType: entry.Type, ServiceName: entry.Name, Region: region, Interface: endpoint.Interface})
+		}
+	}
+	return endpoints
+}
+
+// Regions returns the regions having endpoints in the catalog.
+func (catalog *Catalog) Regions() []string {
+	seen := make(map[string]bool)
+	var regions []string
+	for _, endpoint := range catalog.Endpoints {
+		if endpoint.Region != "" && !seen[endpoint.Region] {
+			seen[endpoint.Region] = true
+			regions = append(regions, endpoint.Region)
+		}
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// Has tells whether the catalog has an endpoint of the exporter of service in
+// region, the one of the cloud entry when empty, for endpointType.
+func (catalog *Catalog) Has(service, region, endpointType string) bool {
+	serviceType := catalogType(service, catalog.cloud)
+	if region == "" {
+		region = catalog.cloud.RegionName
+	}
+	availability := string(GetEndpointType(endpointType))
+
+	for _, endpoint := range catalog.Endpoints {
+		if endpoint.ServiceType == serviceType && endpoint.Interface == availability && (region == "" || endpoint.Region == region) {
+			return true
+		}
+	}
+	return false
+}
+
+// catalogType returns the catalog type of the endpoints used by the exporter
+// of service, which depends on the API version of the cloud entry for volume.
+func catalogType(service string, cloud *clientconfig.Cloud) string {
+	if service != "volume" {
+		return service
+	}
+	switch strings.TrimPrefix(cloud.VolumeAPIVersion, "v") {
+	case "1":
+		return "volume"
+	case "3":
+		return "volumev3"
+	}
+	return "volumev2"
+}
@@ -0,0 +1,51 @@
+package exporters
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+type CatalogTestSuite struct {
+	BaseOpenStackTestSuite
+}
+
+func (suite *CatalogTestSuite) catalogOptions(config ExporterConfig) Options {
+	cloud, err := CloudsYAML{}.Cloud(cloudName)
+	assert.NoError(suite.T(), err)
+	return Options{ExporterConfig: config, Cloud: cloudName, CloudConfig: cloud}
+}
+
+func (suite *CatalogTestSuite) TestCatalogHasServices() {
+	catalog, err := ServiceCatalog(suite.catalogOptions(ExporterConfig{}))
+	assert.NoError(suite.T(), err)
+
+	for _, service := range []string{"compute", "image", "volume", "identity", "container-infra"} {
+		assert.True(suite.T(), catalog.Has(service, "RegionOne", "public"), service)
+	}
+	assert.True(suite.T(), catalog.Has("network", "", "internalURL"))
+	assert.False(suite.T(), catalog.Has("load-balancer", "RegionOne", "public"))
+	assert.False(suite.T(), catalog.Has("compute", "RegionTwo", "public"))
+
+	// The cloud entry doesn't set the volume API version 3.
+	catalog.cloud.VolumeAPIVersion = "3"
+	assert.False(suite.T(), catalog.Has("volume", "RegionOne", "public"))
+}
+
+func (suite *CatalogTestSuite) TestCatalogServicePresent() {
+	providers := NewProviders(suite.Prefix)
+	_, err := ServiceCatalog(suite.catalogOptions(ExporterConfig{Providers: providers}))
+	assert.NoError(suite.T(), err)
+
+	ch := make(chan prometheus.Metric, 100)
+	providers.Collect(ch)
+	close(ch)
+
+	present := 0
+	for metric := range ch {
+		if metric.Desc() == providers.catalogPresent {
+			present++
+		}
+	}
+	// 7 services with a public, internal and admin endpoint each.
+	assert.Equal(suite.T(), 21, present)
+}
@@ -1,15 +1,19 @@
 package exporters
 
 import (
+	"context"
+	"fmt"
 	"strconv"
 	"strings"
 
 	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/schedulerstats"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/services"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/volumetenants"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/snapshots"
 	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/utils/openstack/clientconfig"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -51,20 +55,45 @@ func mapVolumeStatus(volStatus string) int {
 
 var defaultCinderMetrics = []Metric{
 	{Name: "volumes", Fn: ListVolumes},
+	{Name: "volume_status", Labels: []string{"id", "name", "status", "bootable", "tenant_id", "size", "volume_type"}, Fn: nil},
 	{Name: "snapshots", Fn: ListSnapshots},
 	{Name: "agent_state", Labels: []string{"hostname", "service", "adminState", "zone", "disabledReason"}, Fn: ListCinderAgentState},
-	{Name: "volume_status", Labels: []string{"id", "name", "status", "bootable", "tenant_id", "size", "volume_type"}, Fn: nil},
 	{Name: "pool_capacity_free_gb", Labels: []string{"name", "volume_backend_name", "vendor_name"}, Fn: ListCinderPoolCapacityFree},
 	{Name: "pool_capacity_total_gb", Labels: []string{"name", "volume_backend_name", "vendor_name"}, Fn: nil},
 }
 
-func NewCinderExporter(client *gophercloud.ServiceClient, prefix string, disabledMetrics []string) (*CinderExporter, error) {
+func init() {
+	Register(Service{
+		Type:           "volume",
+		Name:           "cinder",
+		DefaultEnabled: true,
+		Metrics:        defaultCinderMetrics,
+		NewClient:      newVolumeClient,
+		NewExporter: func(config *ExporterConfig) (OpenStackExporter, error) {
+			return NewCinderExporter(config)
+		},
+	})
+}
+
+// newVolumeClient returns the client of the block storage API version of the
+// cloud entry, 2 by default.
+func newVolumeClient(provider *gophercloud.ProviderClient, eo gophercloud.EndpointOpts, cloud *clientconfig.Cloud) (*gophercloud.ServiceClient, error) {
+	switch cloud.VolumeAPIVersion {
+	case "v1", "1":
+		return openstack.NewBlockStorageV1(provider, eo)
+	case "", "v2", "2":
+		return openstack.NewBlockStorageV2(provider, eo)
+	case "v3", "3":
+		return openstack.NewBlockStorageV3(provider, eo)
+	}
+	return nil, fmt.Errorf("invalid volume API version")
+}
+
+func NewCinderExporter(config *ExporterConfig) (*CinderExporter, error) {
 	exporter := CinderExporter{
 		BaseOpenStackExporter{
-			Name:            "cinder",
-			Prefix:          prefix,
-			Client:          client,
-			DisabledMetrics: disabledMetrics,
+			Name:           "cinder",
+			ExporterConfig: *config,
 		},
 	}
 	for _, metric := range defaultCinderMetrics {
@@ -74,7 +103,7 @@ func NewCinderExporter(client *gophercloud.ServiceClient, prefix string, disable
 	return &exporter, nil
 }
 
-func ListVolumes(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListVolumes(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	type VolumeWithExt struct {
 		volumes.Volume
 		volumetenants.VolumeTenantExt
@@ -94,12 +123,12 @@ func ListVolumes(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) e
 		return err
 	}
 
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["volumes"].Metric,
+	exporter.EmitMetric(ch, "volumes",
 		prometheus.GaugeValue, float64(len(allVolumes)))
 
 	// Volume status metrics
 	for _, volume := range allVolumes {
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["volume_status"].Metric,
+		exporter.EmitMetric(ch, "volume_status",
 			prometheus.GaugeValue, float64(mapVolumeStatus(volume.Status)), volume.ID, volume.Name,
 			volume.Status, volume.Bootable, volume.TenantID, strconv.Itoa(volume.Size), volume.VolumeType)
 	}
@@ -107,7 +136,7 @@ func ListVolumes(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) e
 	return nil
 }
 
-func ListSnapshots(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListSnapshots(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allSnapshots []snapshots.Snapshot
 
 	allPagesSnapshot, err := snapshots.List(exporter.Client, snapshots.ListOpts{AllTenants: true}).AllPages()
@@ -120,13 +149,13 @@ func ListSnapshots(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric)
 		return err
 	}
 
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["snapshots"].Metric,
+	exporter.EmitMetric(ch, "snapshots",
 		prometheus.GaugeValue, float64(len(allSnapshots)))
 
 	return nil
 }
 
-func ListCinderAgentState(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListCinderAgentState(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allServices []services.Service
 
 	allPagesService, err := services.List(exporter.Client, services.ListOpts{}).AllPages()
@@ -143,14 +172,14 @@ func ListCinderAgentState(exporter *BaseOpenStackExporter, ch chan<- prometheus.
 		if service.State == "up" {
 			state = 1
 		}
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["agent_state"].Metric,
+		exporter.EmitMetric(ch, "agent_state",
 			prometheus.CounterValue, float64(state), service.Host, service.Binary, service.Status, service.Zone, service.DisabledReason)
 	}
 
 	return nil
 }
 
-func ListCinderPoolCapacityFree(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListCinderPoolCapacityFree(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	listOpts := schedulerstats.ListOpts{
 		Detail: true,
 	}
@@ -166,9 +195,9 @@ func ListCinderPoolCapacityFree(exporter *BaseOpenStackExporter, ch chan<- prome
 	}
 
 	for _, stat := range allStats {
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["pool_capacity_free_gb"].Metric, prometheus.GaugeValue,
+		exporter.EmitMetric(ch, "pool_capacity_free_gb", prometheus.GaugeValue,
 			float64(stat.Capabilities.FreeCapacityGB), stat.Name, stat.Capabilities.VolumeBackendName, stat.Capabilities.VendorName)
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["pool_capacity_total_gb"].Metric, prometheus.GaugeValue,
+		exporter.EmitMetric(ch, "pool_capacity_total_gb", prometheus.GaugeValue,
 			float64(stat.Capabilities.TotalCapacityGB), stat.Name, stat.Capabilities.VolumeBackendName, stat.Capabilities.VendorName)
 	}
 	return nil
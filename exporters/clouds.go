@@ -0,0 +1,77 @@
+package exporters
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"gopkg.in/yaml.v2"
+)
+
+// CloudsYAML loads the cloud entries of the clouds.yaml file at Path, or of
+// the one found in the standard locations when Path is empty, completed by
+// secure.yaml and clouds-public.yaml.
+type CloudsYAML struct {
+	Path string
+}
+
+func (clouds CloudsYAML) LoadCloudsYAML() (map[string]clientconfig.Cloud, error) {
+	if clouds.Path == "" {
+		return clientconfig.LoadCloudsYAML()
+	}
+
+	content, err := ioutil.ReadFile(clouds.Path)
+	if err != nil {
+		return nil, err
+	}
+	var parsed clientconfig.Clouds
+	if err := yaml.Unmarshal(content, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal yaml: %v", err)
+	}
+	return parsed.Clouds, nil
+}
+
+func (clouds CloudsYAML) LoadSecureCloudsYAML() (map[string]clientconfig.Cloud, error) {
+	return clientconfig.LoadSecureCloudsYAML()
+}
+
+func (clouds CloudsYAML) LoadPublicCloudsYAML() (map[string]clientconfig.Cloud, error) {
+	return clientconfig.LoadPublicCloudsYAML()
+}
+
+// Cloud returns the entry of cloud.
+func (clouds CloudsYAML) Cloud(cloud string) (*clientconfig.Cloud, error) {
+	return clientconfig.GetCloudFromYAML(&clientconfig.ClientOpts{Cloud: cloud, YAMLOpts: clouds})
+}
+
+// cloudEntry serves a single cloud entry already loaded to clientconfig, so
+// that it authenticates with it rather than with the files.
+type cloudEntry struct {
+	name  string
+	cloud clientconfig.Cloud
+}
+
+// clientOpts returns the options authenticating with the entry of cloud named
+// name.
+func clientOpts(name string, cloud *clientconfig.Cloud) *clientconfig.ClientOpts {
+	if name == "" {
+		name = "default"
+	}
+	entry := cloudEntry{name: name, cloud: *cloud}
+	// The profile of the entry was merged when it was loaded.
+	entry.cloud.Profile = ""
+	entry.cloud.Cloud = ""
+	return &clientconfig.ClientOpts{Cloud: name, RegionName: cloud.RegionName, YAMLOpts: entry}
+}
+
+func (entry cloudEntry) LoadCloudsYAML() (map[string]clientconfig.Cloud, error) {
+	return map[string]clientconfig.Cloud{entry.name: entry.cloud}, nil
+}
+
+func (entry cloudEntry) LoadSecureCloudsYAML() (map[string]clientconfig.Cloud, error) {
+	return nil, nil
+}
+
+func (entry cloudEntry) LoadPublicCloudsYAML() (map[string]clientconfig.Cloud, error) {
+	return nil, nil
+}
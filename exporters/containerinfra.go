@@ -1,7 +1,8 @@
 package exporters
 
 import (
-	"github.com/gophercloud/gophercloud"
+	"context"
+	"github.com/gophercloud/gophercloud/openstack"
 	"github.com/gophercloud/gophercloud/openstack/containerinfra/v1/clusters"
 	"github.com/prometheus/client_golang/prometheus"
 	"strconv"
@@ -46,13 +47,24 @@ var defaultContainerInfraMetrics = []Metric{
 	{Name: "cluster_status", Labels: []string{"uuid", "name", "stack_id", "status", "node_count", "master_count"}, Fn: nil},
 }
 
-func NewContainerInfraExporter(client *gophercloud.ServiceClient, prefix string, disabledMetrics []string) (*ContainerInfraExporter, error) {
+func init() {
+	Register(Service{
+		Type:           "container-infra",
+		Name:           "container_infra",
+		DefaultEnabled: true,
+		Metrics:        defaultContainerInfraMetrics,
+		NewClient:      catalogClient(openstack.NewContainerInfraV1),
+		NewExporter: func(config *ExporterConfig) (OpenStackExporter, error) {
+			return NewContainerInfraExporter(config)
+		},
+	})
+}
+
+func NewContainerInfraExporter(config *ExporterConfig) (*ContainerInfraExporter, error) {
 	exporter := ContainerInfraExporter{
 		BaseOpenStackExporter{
-			Name:            "container_infra",
-			Prefix:          prefix,
-			Client:          client,
-			DisabledMetrics: disabledMetrics,
+			Name:           "container_infra",
+			ExporterConfig: *config,
 		},
 	}
 	for _, metric := range defaultContainerInfraMetrics {
@@ -61,7 +73,7 @@ func NewContainerInfraExporter(client *gophercloud.ServiceClient, prefix string,
 	return &exporter, nil
 }
 
-func ListAllClusters(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListAllClusters(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allClusters []clusters.Cluster
 	allPagesClusters, err := clusters.List(exporter.Client, clusters.ListOpts{}).AllPages()
 	if err != nil {
@@ -71,11 +83,11 @@ func ListAllClusters(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metri
 	if err != nil {
 		return err
 	}
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["total_clusters"].Metric,
+	exporter.EmitMetric(ch, "total_clusters",
 		prometheus.GaugeValue, float64(len(allClusters)))
 	// Cluster status metrics
 	for _, cluster := range allClusters {
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["cluster_status"].Metric,
+		exporter.EmitMetric(ch, "cluster_status",
 			prometheus.GaugeValue, float64(mapClusterStatus(cluster.Status)), cluster.UUID, cluster.Name,
 			cluster.StackID, cluster.Status, strconv.Itoa(cluster.NodeCount), strconv.Itoa(cluster.MasterCount))
 	}
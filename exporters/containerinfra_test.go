@@ -1,9 +1,6 @@
 package exporters
 
 import (
-	"strings"
-
-	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -14,23 +11,29 @@ type ContainerInfraTestSuite struct {
 var containerInfraExpectedUp = `
 # HELP openstack_container_infra_cluster_status cluster_status
 # TYPE openstack_container_infra_cluster_status gauge
-openstack_container_infra_cluster_status{master_count="1",name="k8s",node_count="1",stack_id="31c1ee6c-081e-4f39-9f0f-f1d87a7defa1",status="CREATE_FAILED",uuid="273c39d5-fa17-4372-b6b1-93a572de2cef"} 1
+openstack_container_infra_cluster_status{master_count="1",name="k8s",node_count="1",region="RegionOne",stack_id="31c1ee6c-081e-4f39-9f0f-f1d87a7defa1",status="CREATE_FAILED",uuid="273c39d5-fa17-4372-b6b1-93a572de2cef"} 1
 # HELP openstack_container_infra_total_clusters total_clusters
 # TYPE openstack_container_infra_total_clusters gauge
-openstack_container_infra_total_clusters 1
+openstack_container_infra_total_clusters{region="RegionOne"} 1
 # HELP openstack_container_infra_up up
 # TYPE openstack_container_infra_up gauge
-openstack_container_infra_up 1
+openstack_container_infra_up{region="RegionOne"} 1
+# HELP openstack_scrape_collector_success Whether the collection of a metric from the OpenStack API succeeded
+# TYPE openstack_scrape_collector_success gauge
+openstack_scrape_collector_success{collector="total_clusters",region="RegionOne",service="container_infra"} 1
 `
 
 var containerInfraExpectedDown = `
 # HELP openstack_container_infra_up up
 # TYPE openstack_container_infra_up gauge
-openstack_container_infra_up 0
+openstack_container_infra_up{region="RegionOne"} 0
+# HELP openstack_scrape_collector_success Whether the collection of a metric from the OpenStack API succeeded
+# TYPE openstack_scrape_collector_success gauge
+openstack_scrape_collector_success{collector="total_clusters",region="RegionOne",service="container_infra"} 0
 `
 
 func (suite *ContainerInfraTestSuite) TestContainerInfraExporter() {
-	err := testutil.CollectAndCompare(*suite.Exporter, strings.NewReader(containerInfraExpectedUp))
+	err := suite.CollectAndCompare(containerInfraExpectedUp)
 	assert.NoError(suite.T(), err)
 }
 
@@ -38,6 +41,6 @@ func (suite *ContainerInfraTestSuite) TestContainerInfraExporterWithEndpointDown
 	suite.teardownFixtures()
 	defer suite.installFixtures()
 
-	err := testutil.CollectAndCompare(*suite.Exporter, strings.NewReader(containerInfraExpectedDown))
+	err := suite.CollectAndCompare(containerInfraExpectedDown)
 	assert.NoError(suite.T(), err)
 }
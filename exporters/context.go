@@ -0,0 +1,104 @@
+package exporters
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// runListFunc runs fn until it returns or ctx is done, whichever comes first.
+// A ListFunc stuck in a call that ignores ctx is left behind, and whatever it
+// sends afterwards is dropped so that it never writes to a finished scrape.
+// The invalid metrics sent by fn are dropped and fail the collection, as well
+// as a panic of fn.
+func runListFunc(ctx context.Context, fn ListFunc, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+	metrics := make(chan prometheus.Metric)
+	done := make(chan error, 1)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- fn(ctx, exporter, metrics)
+	}()
+
+	invalid := 0
+	var invalidErr error
+	for {
+		select {
+		case metric := <-metrics:
+			if err := metric.Write(&dto.Metric{}); err != nil {
+				exporter.logger().Debugf("Dropping invalid metric %s: %s", metric.Desc(), err)
+				invalid++
+				invalidErr = err
+				continue
+			}
+			ch <- metric
+		case err := <-done:
+			if err == nil && invalid > 0 {
+				err = fmt.Errorf("%d invalid metrics, last error: %s", invalid, invalidErr)
+			}
+			return err
+		case <-ctx.Done():
+			go func() {
+				for {
+					select {
+					case <-metrics:
+					case <-done:
+						return
+					}
+				}
+			}()
+			return ctx.Err()
+		}
+	}
+}
+
+// clientWithContext returns a copy of client whose requests are bound to ctx.
+// The copy shares the token of the original client: a re-authentication done
+// through either of them is seen by both.
+func clientWithContext(ctx context.Context, client *gophercloud.ServiceClient) *gophercloud.ServiceClient {
+	if client == nil {
+		return nil
+	}
+
+	original := client.ProviderClient
+	provider := *original
+	provider.Context = ctx
+	if reauth := original.ReauthFunc; reauth != nil {
+		provider.ReauthFunc = func() error {
+			// Another collection may have renewed the token in the meantime.
+			if original.Token() == provider.Token() {
+				if err := reauth(); err != nil {
+					return err
+				}
+			}
+			provider.CopyTokenFrom(original)
+			return nil
+		}
+	}
+
+	scoped := *client
+	scoped.ProviderClient = &provider
+	return &scoped
+}
+
+type contextCollector struct {
+	OpenStackExporter
+	ctx context.Context
+}
+
+// WithContext returns a collector running the collections of exporter bound to
+// ctx, typically the context of the scrape request.
+func WithContext(ctx context.Context, exporter OpenStackExporter) prometheus.Collector {
+	return contextCollector{OpenStackExporter: exporter, ctx: ctx}
+}
+
+func (collector contextCollector) Collect(ch chan<- prometheus.Metric) {
+	collector.CollectContext(collector.ctx, ch)
+}
@@ -0,0 +1,57 @@
+package exporters
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectHonoursTimeout(t *testing.T) {
+	exporter := BaseOpenStackExporter{
+		Name:           "test",
+		ExporterConfig: ExporterConfig{Prefix: "openstack", Timeout: 10 * time.Millisecond},
+	}
+	// A ListFunc ignoring its context must not hold the scrape past the timeout.
+	exporter.AddMetric("stuck", func(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+		time.Sleep(time.Second)
+		return nil
+	}, nil, nil)
+
+	start := time.Now()
+	err := testutil.CollectAndCompare(&exporter, strings.NewReader(`
+# HELP openstack_scrape_collector_success Whether the collection of a metric from the OpenStack API succeeded
+# TYPE openstack_scrape_collector_success gauge
+openstack_scrape_collector_success{collector="stuck",service="test"} 0
+# HELP openstack_test_up up
+# TYPE openstack_test_up gauge
+openstack_test_up 0
+`), "openstack_scrape_collector_success", "openstack_test_up")
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestWithContextCancelsCollection(t *testing.T) {
+	exporter := BaseOpenStackExporter{
+		Name:           "test",
+		ExporterConfig: ExporterConfig{Prefix: "openstack"},
+	}
+	exporter.AddMetric("cancelled", func(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := testutil.CollectAndCompare(WithContext(ctx, &exporter), strings.NewReader(`
+# HELP openstack_test_up up
+# TYPE openstack_test_up gauge
+openstack_test_up 0
+`), "openstack_test_up")
+	assert.NoError(t, err)
+}
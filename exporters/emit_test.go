@@ -0,0 +1,107 @@
+package exporters
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmitMetricNeverPanics(t *testing.T) {
+	exporter := BaseOpenStackExporter{
+		Name:           "test",
+		ExporterConfig: ExporterConfig{Prefix: "openstack", DisabledMetrics: []string{"test-disabled"}},
+	}
+	exporter.AddMetric("valid", func(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+		exporter.EmitMetric(ch, "valid", prometheus.GaugeValue, 1, "a")
+		// Disabled siblings are skipped.
+		exporter.EmitMetric(ch, "disabled", prometheus.GaugeValue, 1)
+		return nil
+	}, []string{"label"}, nil)
+	exporter.AddMetric("disabled", nil, nil, nil)
+	exporter.AddMetric("wrong_labels", func(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+		exporter.EmitMetric(ch, "wrong_labels", prometheus.GaugeValue, 1, "a", "b")
+		return nil
+	}, []string{"label"}, nil)
+	exporter.AddMetric("panics", func(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+		var labels []string
+		exporter.EmitMetric(ch, "panics", prometheus.GaugeValue, 1, labels[0])
+		return nil
+	}, []string{"label"}, nil)
+
+	err := testutil.CollectAndCompare(&exporter, strings.NewReader(`
+# HELP openstack_scrape_collector_success Whether the collection of a metric from the OpenStack API succeeded
+# TYPE openstack_scrape_collector_success gauge
+openstack_scrape_collector_success{collector="panics",service="test"} 0
+openstack_scrape_collector_success{collector="valid",service="test"} 1
+openstack_scrape_collector_success{collector="wrong_labels",service="test"} 0
+# HELP openstack_test_up up
+# TYPE openstack_test_up gauge
+openstack_test_up 0
+# HELP openstack_test_valid valid
+# TYPE openstack_test_valid gauge
+openstack_test_valid{label="a"} 1
+`), "openstack_scrape_collector_success", "openstack_test_up", "openstack_test_valid", "openstack_test_wrong_labels", "openstack_test_disabled")
+	assert.NoError(t, err)
+}
+
+func TestEmitMetricSeriesLimits(t *testing.T) {
+	var logs bytes.Buffer
+	exporter := BaseOpenStackExporter{
+		Name: "test",
+		ExporterConfig: ExporterConfig{
+			Prefix:    "openstack",
+			MaxSeries: SeriesLimits{PerMetric: 3},
+			Logger:    log.NewLogger(&logs),
+		},
+	}
+	exporter.AddMetric("many", func(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+		for _, id := range []string{"a", "b", "c", "d", "e"} {
+			exporter.EmitMetric(ch, "many", prometheus.GaugeValue, 1, id)
+		}
+		return nil
+	}, []string{"id"}, nil)
+	exporter.AddMetric("few", func(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+		exporter.EmitMetric(ch, "few", prometheus.GaugeValue, 1, "a")
+		return nil
+	}, []string{"id"}, nil)
+
+	err := testutil.CollectAndCompare(&exporter, strings.NewReader(`
+# HELP openstack_test_few few
+# TYPE openstack_test_few gauge
+openstack_test_few{id="a"} 1
+# HELP openstack_test_many many
+# TYPE openstack_test_many gauge
+openstack_test_many{id="a"} 1
+openstack_test_many{id="b"} 1
+openstack_test_many{id="c"} 1
+# HELP openstack_test_series_dropped_total Number of series dropped over the series limits
+# TYPE openstack_test_series_dropped_total counter
+openstack_test_series_dropped_total{metric="many"} 2
+`), "openstack_test_few", "openstack_test_many", "openstack_test_series_dropped_total")
+	assert.NoError(t, err)
+	assert.Contains(t, logs.String(), "Dropped 2 series of metric: many for exporter: openstack_test")
+
+	// The dropped series add up across the collections, and the limit of the
+	// service applies to all its metrics, cut in the order of their names.
+	exporter.MaxSeries = SeriesLimits{PerService: 4}
+	err = testutil.CollectAndCompare(&exporter, strings.NewReader(`
+# HELP openstack_test_few few
+# TYPE openstack_test_few gauge
+openstack_test_few{id="a"} 1
+# HELP openstack_test_many many
+# TYPE openstack_test_many gauge
+openstack_test_many{id="a"} 1
+openstack_test_many{id="b"} 1
+openstack_test_many{id="c"} 1
+# HELP openstack_test_series_dropped_total Number of series dropped over the series limits
+# TYPE openstack_test_series_dropped_total counter
+openstack_test_series_dropped_total{metric="many"} 4
+`), "openstack_test_few", "openstack_test_many", "openstack_test_series_dropped_total")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,81 @@
+package exporters
+
+import (
+	"net/http"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type EndpointTestSuite struct {
+	BaseOpenStackTestSuite
+}
+
+func (suite *EndpointTestSuite) TestEndpointOverride() {
+	suite.SetResponseFromFixture("GET", 200, "https://glance.example.com:9292/v2/images", suite.FixturePath("glance_images"))
+
+	exporter, err := NewExporter("image", cloudName, "public", ExporterConfig{
+		Prefix:   suite.Prefix,
+		Endpoint: "https://glance.example.com:9292",
+	})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "https://glance.example.com:9292/", exporter.Status().Endpoint)
+
+	suite.Exporter = &exporter
+	assert.NoError(suite.T(), suite.CollectAndCompare(`
+# HELP openstack_glance_images images
+# TYPE openstack_glance_images gauge
+openstack_glance_images{region="RegionOne"} 2
+# HELP openstack_glance_up up
+# TYPE openstack_glance_up gauge
+openstack_glance_up{region="RegionOne"} 1
+# HELP openstack_scrape_collector_success Whether the collection of a metric from the OpenStack API succeeded
+# TYPE openstack_scrape_collector_success gauge
+openstack_scrape_collector_success{collector="images",region="RegionOne",service="glance"} 1
+`))
+	assert.NotZero(suite.T(), httpmock.GetCallCountInfo()["GET https://glance.example.com:9292/v2/images"])
+}
+
+func (suite *EndpointTestSuite) TestEndpointMissingFromCatalog() {
+	// The load-balancer service isn't in the catalog of the test cloud.
+	_, err := NewExporter("load-balancer", cloudName, "public", ExporterConfig{Prefix: suite.Prefix})
+	assert.Error(suite.T(), err)
+
+	httpmock.RegisterResponder("GET", "https://octavia.example.com:9876/", func(request *http.Request) (*http.Response, error) {
+		response := httpmock.NewStringResponse(200, `{"versions": [{"id": "v2.0", "status": "CURRENT"}]}`)
+		response.Header = http.Header{"Content-Type": []string{"application/json"}}
+		response.Request = request
+		return response, nil
+	})
+
+	exporter, err := NewExporter("load-balancer", cloudName, "public", ExporterConfig{
+		Prefix:       suite.Prefix,
+		Endpoint:     "https://octavia.example.com:9876/v2.0/",
+		Microversion: LatestMicroversion,
+	})
+	assert.NoError(suite.T(), err)
+	client := exporter.(*LoadbalancerExporter).Client
+	assert.Equal(suite.T(), "load-balancer", client.Type)
+	assert.Equal(suite.T(), "https://octavia.example.com:9876/v2.0/", client.ResourceBase)
+	assert.Equal(suite.T(), "2.0", exporter.Status().Microversion)
+}
+
+func (suite *EndpointTestSuite) TestIdentityEndpoint() {
+	exporter, err := NewExporter("compute", cloudName, "public", ExporterConfig{
+		Prefix:               suite.Prefix,
+		IdentityEndpointType: "internal",
+	})
+	assert.NoError(suite.T(), err)
+	client, err := identityClient(&exporter.(*NovaExporter).BaseOpenStackExporter)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "http://test.cloud/identity/v3/", client.Endpoint)
+
+	exporter, err = NewExporter("compute", cloudName, "public", ExporterConfig{
+		Prefix:           suite.Prefix,
+		IdentityEndpoint: "https://keystone.example.com:5000/v3",
+	})
+	assert.NoError(suite.T(), err)
+	client, err = identityClient(&exporter.(*NovaExporter).BaseOpenStackExporter)
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), "https://keystone.example.com:5000/v3/", client.Endpoint)
+}
@@ -1,9 +1,12 @@
 package exporters
 
 import (
-	"crypto/tls"
+	"context"
 	"fmt"
 	"net/http"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/utils/openstack/clientconfig"
@@ -11,6 +14,8 @@ import (
 	"github.com/prometheus/common/log"
 )
 
+// Metric is a metric of an exporter. A metric without Fn is collected by the
+// Fn of the last metric added before it with one, the owner of its group.
 type Metric struct {
 	Name   string
 	Labels []string
@@ -34,195 +39,476 @@ type OpenStackExporter interface {
 	GetName() string
 	AddMetric(name string, fn ListFunc, labels []string, constLabels prometheus.Labels)
 	MetricIsDisabled(name string) bool
+	StartPolling()
+	Stop()
+	CollectContext(ctx context.Context, ch chan<- prometheus.Metric)
+	Status() Status
 }
 
-func EnableExporter(service, prefix, cloud string, disabledMetrics []string, endpointType string) (*OpenStackExporter, error) {
-	exporter, err := NewExporter(service, prefix, cloud, disabledMetrics, endpointType)
+// ExporterConfig holds the settings shared by all the service exporters.
+type ExporterConfig struct {
+	Client *gophercloud.ServiceClient
+	Prefix string
+	// DisabledMetrics are the patterns of the service-metric names which must
+	// not be collected.
+	DisabledMetrics []string
+	// EnabledMetrics, when set, are the patterns of the only service-metric
+	// names which must be collected.
+	EnabledMetrics []string
+	// RefreshInterval enables background polling when set: metrics are collected
+	// every RefreshInterval and scrapes are served from the last snapshot.
+	RefreshInterval time.Duration
+	// Concurrency is the maximum number of ListFuncs run at the same time by
+	// the exporter, zero or less doesn't limit them.
+	Concurrency int
+	// GlobalLimiter bounds the number of ListFuncs run at the same time across
+	// all the exporters sharing it.
+	GlobalLimiter Limiter
+	// Timeout is the deadline given to a whole collection of the exporter, zero
+	// doesn't set any.
+	Timeout time.Duration
+	// APIMetrics, when set, records the requests sent to the OpenStack APIs.
+	APIMetrics *APIMetrics
+	// Region is the region of the endpoints used by the exporter, it defaults to
+	// the region of the cloud entry and labels all the metrics.
+	Region string
+	// Providers, when set, shares the authenticated provider client of each
+	// cloud between the exporters using it.
+	Providers *Providers
+	// Retry is how the requests failed because the API is unavailable or
+	// throttling are retried.
+	Retry RetryPolicy
+	// RateLimits, when set, bounds the rate of the requests sent to each API
+	// endpoint.
+	RateLimits *RateLimits
+	// Endpoint, when set, is the URL of the API used by the exporter instead of
+	// the endpoint of the service catalog.
+	Endpoint string
+	// IdentityEndpointType and IdentityEndpoint locate the identity API listing
+	// the projects of the compute limits, defaulting to the endpoint type of
+	// the exporter and to the endpoint of the service catalog.
+	IdentityEndpointType string
+	IdentityEndpoint     string
+	// Microversion pins the microversion of the compute, volume and
+	// load-balancer APIs. When empty, the base microversion is used, and with
+	// LatestMicroversion the highest one supported by both the API and the
+	// exporter is negotiated. It holds the microversion in use once the exporter
+	// is built.
+	Microversion string
+	// MaxSeries caps the number of series sent by each collection, the ones
+	// over the limits being dropped and counted in series_dropped_total.
+	MaxSeries SeriesLimits
+	// Logger receives the logs of the exporter, the default logger of
+	// github.com/prometheus/common/log when nil.
+	Logger log.Logger
+	// Registry holds the services the exporter can be built for,
+	// DefaultRegistry when nil.
+	Registry *Registry
+	// Registerer is where EnableExporter registers the exporter,
+	// prometheus.DefaultRegisterer when nil.
+	Registerer prometheus.Registerer
+	// endpointOpts locate the endpoints of the exporter in the catalog.
+	endpointOpts gophercloud.EndpointOpts
+}
+
+func (config *ExporterConfig) logger() log.Logger {
+	if config.Logger != nil {
+		return config.Logger
+	}
+	return log.Base()
+}
+
+func (config *ExporterConfig) registerer() prometheus.Registerer {
+	if config.Registerer != nil {
+		return config.Registerer
+	}
+	return prometheus.DefaultRegisterer
+}
+
+func EnableExporter(service, cloud, endpointType string, config ExporterConfig) (*OpenStackExporter, error) {
+	exporter, err := NewExporter(service, cloud, endpointType, config)
 	if err != nil {
 		return nil, err
 	}
-	prometheus.MustRegister(exporter)
+	config.registerer().MustRegister(exporter)
 	return &exporter, nil
 }
 
 type PrometheusMetric struct {
 	Metric *prometheus.Desc
+	Labels []string
 	Fn     ListFunc
+	// disabled is set on the owner of a group left out by the filters, which
+	// is only kept to run Fn for the other metrics of its group.
+	disabled bool
 }
 
 type BaseOpenStackExporter struct {
-	Name            string
-	Prefix          string
-	Metrics         map[string]*PrometheusMetric
-	Client          *gophercloud.ServiceClient
-	DisabledMetrics []string
+	ExporterConfig
+	Name              string
+	Metrics           map[string]*PrometheusMetric
+	collectorDuration *prometheus.Desc
+	collectorSuccess  *prometheus.Desc
+	snapshot          *snapshot
+	status            *collectionStatus
+	dropped           *droppedSeries
+	// owner is the last metric added with a ListFunc, which collects the
+	// metrics added after it without one.
+	owner Metric
+	// series is the budget of the collection run by the ListFuncs, if any.
+	series *seriesBudget
+	// disabled are the names of the metrics left out by the filters.
+	disabled []string
 }
 
-type ListFunc func(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error
-
-var endpointOpts map[string]gophercloud.EndpointOpts
+// ListFunc collects metrics from the OpenStack API into ch. The requests made
+// through exporter.Client are bound to ctx, and a ListFunc looping over many
+// resources should give up once ctx is done.
+type ListFunc func(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error
 
 func (exporter *BaseOpenStackExporter) GetName() string {
 	return fmt.Sprintf("%s_%s", exporter.Prefix, exporter.Name)
 }
 
+// MetricIsDisabled tells whether the metric is matched by a pattern of
+// DisabledMetrics or, when EnabledMetrics is set, by none of its patterns.
 func (exporter *BaseOpenStackExporter) MetricIsDisabled(name string) bool {
-	for _, metric := range exporter.DisabledMetrics {
-		if metric == fmt.Sprintf("%s-%s", exporter.Name, name) {
-			return true
-		}
+	metric := fmt.Sprintf("%s-%s", exporter.Name, name)
+	if len(exporter.EnabledMetrics) > 0 && !matchAnyMetric(exporter.EnabledMetrics, metric) {
+		return true
 	}
-	return false
+	return matchAnyMetric(exporter.DisabledMetrics, metric)
 }
 
 func (exporter *BaseOpenStackExporter) Describe(ch chan<- *prometheus.Desc) {
 	for _, metric := range exporter.Metrics {
-		ch <- metric.Metric
+		if !metric.disabled {
+			ch <- metric.Metric
+		}
 	}
+	ch <- exporter.collectorDuration
+	ch <- exporter.collectorSuccess
+	ch <- exporter.dropped.desc
 }
 
 func (exporter *BaseOpenStackExporter) Collect(ch chan<- prometheus.Metric) {
+	exporter.CollectContext(context.Background(), ch)
+}
+
+// CollectContext is like Collect, with the API requests bound to ctx. The
+// exporter Timeout is applied on top of any deadline already set on ctx.
+func (exporter *BaseOpenStackExporter) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	if exporter.snapshot != nil {
+		exporter.snapshot.replay(exporter, ch)
+		return
+	}
+	exporter.collectMetrics(ctx, ch)
+}
+
+func (exporter *BaseOpenStackExporter) collectMetrics(ctx context.Context, ch chan<- prometheus.Metric) {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
 	serviceUp := true
+	results := make(map[string]CollectorStatus)
+	authFailed := false
+
+	if exporter.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, exporter.Timeout)
+		defer cancel()
+	}
 
+	if !hasCache(ctx) {
+		ctx = WithCache(ctx)
+	}
+
+	// ListFuncs get a copy of the exporter whose client requests are bound to
+	// ctx, and whose series are counted against the limits.
+	scoped := *exporter
+	scoped.Client = clientWithContext(ctx, exporter.Client)
+	scoped.series = newSeriesBudget(exporter.MaxSeries)
+
+	limiter := NewLimiter(exporter.Concurrency)
 	for name, metric := range exporter.Metrics {
-		log.Infof("Collecting metrics for exporter: %s, metric: %s", exporter.GetName(), name)
 		if metric.Fn == nil {
-			log.Debugf("No function handler set for metric: %s", name)
+			exporter.logger().Debugf("No function handler set for metric: %s", name)
 			continue
 		}
 
-		err := metric.Fn(exporter, ch)
-		if err != nil {
-			log.Errorln(err)
-			serviceUp = false
-		}
+		wg.Add(1)
+		go func(name string, fn ListFunc) {
+			defer wg.Done()
+
+			limiter.Acquire()
+			defer limiter.Release()
+			exporter.GlobalLimiter.Acquire()
+			defer exporter.GlobalLimiter.Release()
+
+			exporter.logger().Infof("Collecting metrics for exporter: %s, metric: %s", exporter.GetName(), name)
+			start := time.Now()
+			err := runListFunc(ctx, fn, &scoped, ch)
+			duration := time.Since(start)
+
+			result := CollectorStatus{Timestamp: time.Now(), Duration: duration.Seconds()}
+			success := 1.0
+			if err != nil {
+				exporter.logger().Errorf("Collecting metric: %s for exporter: %s failed: %s", name, exporter.GetName(), err)
+				success = 0
+				result.Error = err.Error()
+			}
+			mutex.Lock()
+			results[name] = result
+			if err != nil {
+				serviceUp = false
+				authFailed = authFailed || isAuthError(err)
+			}
+			mutex.Unlock()
+
+			ch <- prometheus.MustNewConstMetric(exporter.collectorDuration, prometheus.GaugeValue, duration.Seconds(), name)
+			ch <- prometheus.MustNewConstMetric(exporter.collectorSuccess, prometheus.GaugeValue, success, name)
+		}(name, metric.Fn)
 	}
+	wg.Wait()
+
+	if exporter.status != nil {
+		exporter.status.record(results, authFailed)
+	}
+	scoped.series.flush(ch)
+	exporter.dropped.record(scoped.series, exporter.logger(), exporter.GetName())
+	exporter.dropped.collect(ch)
 
 	if serviceUp {
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["up"].Metric, prometheus.GaugeValue, 1)
+		exporter.EmitMetric(ch, "up", prometheus.GaugeValue, 1)
 	} else {
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["up"].Metric, prometheus.GaugeValue, 0)
+		exporter.EmitMetric(ch, "up", prometheus.GaugeValue, 0)
 	}
 }
 
 func (exporter *BaseOpenStackExporter) AddMetric(name string, fn ListFunc, labels []string, constLabels prometheus.Labels) {
+	// The up and collector metrics are needed even when all the metrics of the
+	// exporter are disabled.
+	if exporter.Metrics == nil {
+		exporter.initMetrics()
+	}
+
+	if fn != nil {
+		exporter.owner = Metric{Name: name, Labels: labels, Fn: fn}
+	}
 
 	if exporter.MetricIsDisabled(name) {
-		log.Warnf("metric: %s has been disabled on %s exporter, not collecting metrics", name, exporter.Name)
+		exporter.logger().Warnf("metric: %s has been disabled on %s exporter, not collecting metrics", name, exporter.Name)
+		exporter.disabled = append(exporter.disabled, name)
 		return
 	}
 
-	if exporter.Metrics == nil {
-		exporter.Metrics = make(map[string]*PrometheusMetric)
-		exporter.Metrics["up"] = &PrometheusMetric{
-			Metric: prometheus.NewDesc(
-				prometheus.BuildFQName(exporter.GetName(), "", "up"),
-				"up", nil, constLabels),
-			Fn: nil,
+	// The ListFunc of the group runs as long as one of its metrics is enabled,
+	// the series of the disabled owner being dropped by EmitMetric.
+	if owner := exporter.owner; fn == nil && owner.Fn != nil {
+		if _, ok := exporter.Metrics[owner.Name]; !ok {
+			exporter.addMetric(owner.Name, owner.Fn, owner.Labels, nil)
+			exporter.Metrics[owner.Name].disabled = true
 		}
 	}
 
+	exporter.addMetric(name, fn, labels, constLabels)
+}
+
+// EmitMetric sends the value of the metric to ch. Nothing is sent when the
+// metric is disabled or over the series limits, and a metric that can't be
+// built, i.e. because of a wrong number of label values, is sent as an invalid
+// metric which fails the collection instead of panicking.
+func (exporter *BaseOpenStackExporter) EmitMetric(ch chan<- prometheus.Metric, name string, valueType prometheus.ValueType, value float64, labelValues ...string) {
+	metric, ok := exporter.Metrics[name]
+	if !ok || metric.disabled {
+		return
+	}
+
+	constMetric, err := prometheus.NewConstMetric(metric.Metric, valueType, value, labelValues...)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(metric.Metric, err)
+		return
+	}
+	exporter.series.send(ch, name, constMetric)
+}
+
+func (exporter *BaseOpenStackExporter) initMetrics() {
+	exporter.Metrics = make(map[string]*PrometheusMetric)
+	exporter.status = newCollectionStatus()
+	exporter.addMetric("up", nil, nil, nil)
+
+	// The collector metrics are shared by all the services, which are told
+	// apart by their service label.
+	collectorLabels := prometheus.Labels{"service": exporter.Name}
+	if exporter.Region != "" {
+		collectorLabels["region"] = exporter.Region
+	}
+	exporter.collectorDuration = prometheus.NewDesc(
+		prometheus.BuildFQName(exporter.Prefix, "scrape", "collector_duration_seconds"),
+		"Duration of the collection of a metric from the OpenStack API", []string{"collector"}, collectorLabels)
+	exporter.collectorSuccess = prometheus.NewDesc(
+		prometheus.BuildFQName(exporter.Prefix, "scrape", "collector_success"),
+		"Whether the collection of a metric from the OpenStack API succeeded", []string{"collector"}, collectorLabels)
+
+	var droppedLabels prometheus.Labels
+	if exporter.Region != "" {
+		droppedLabels = prometheus.Labels{"region": exporter.Region}
+	}
+	exporter.dropped = newDroppedSeries(prometheus.NewDesc(
+		prometheus.BuildFQName(exporter.GetName(), "", "series_dropped_total"),
+		"Number of series dropped over the series limits", []string{"metric"}, droppedLabels))
+}
+
+// addMetric adds the metric regardless of the filters.
+func (exporter *BaseOpenStackExporter) addMetric(name string, fn ListFunc, labels []string, constLabels prometheus.Labels) {
+	if exporter.Metrics == nil {
+		exporter.initMetrics()
+	}
+
 	if constLabels == nil {
 		constLabels = prometheus.Labels{}
 	}
 
-	// @TODO: get the region. constLabels["region"] = exporter.
+	if exporter.Region != "" {
+		constLabels["region"] = exporter.Region
+	}
 
 	if _, ok := exporter.Metrics[name]; !ok {
-		log.Infof("Adding metric: %s to exporter: %s", name, exporter.Name)
+		exporter.logger().Infof("Adding metric: %s to exporter: %s", name, exporter.Name)
 		exporter.Metrics[name] = &PrometheusMetric{
 			Metric: prometheus.NewDesc(
 				prometheus.BuildFQName(exporter.GetName(), "", name),
 				name, labels, constLabels),
-			Fn: fn,
+			Labels: labels,
+			Fn:     fn,
 		}
 	}
 }
 
-func NewExporter(name, prefix, cloud string, disabledMetrics []string, endpointType string) (OpenStackExporter, error) {
-	var exporter OpenStackExporter
-	var err error
-	var transport *http.Transport
+// ExporterName returns the name of the exporter of service, which is the
+// subsystem of its metrics and the prefix of its --disable-metric entries.
+func ExporterName(service string) (string, error) {
+	registered, err := DefaultRegistry.Service(service)
+	if err != nil {
+		return "", err
+	}
+	return registered.Name, nil
+}
+
+// Options are the settings of an exporter built by New, which reads neither
+// the environment nor clouds.yaml.
+type Options struct {
+	ExporterConfig
+	// Service is the type of the service of the exporter.
+	Service string
+	// Cloud names the cloud, whose provider client is shared by its exporters
+	// when Providers is set.
+	Cloud string
+	// CloudConfig is the entry of the cloud, as loaded from clouds.yaml.
+	CloudConfig *clientconfig.Cloud
+	// EndpointType is the interface of the endpoint of the service.
+	EndpointType string
+	// Transport sends the requests to the APIs of the cloud. When nil, a
+	// transport using the CA bundle and client certificate of CloudConfig is
+	// used.
+	Transport http.RoundTripper
+}
+
+// providerClient returns an authenticated provider client for the cloud of
+// options, shared with the other exporters of the cloud when Providers is set.
+func providerClient(options Options) (*gophercloud.ProviderClient, error) {
+	config := options.ExporterConfig
+	transport := options.Transport
+	if transport == nil {
+		var err error
+		if transport, err = cloudTransport(options.CloudConfig, config.logger()); err != nil {
+			return nil, err
+		}
+	}
+	// Every attempt of a retried request is recorded, with its own status
+	// code and duration.
+	if config.APIMetrics != nil {
+		transport = config.APIMetrics.Transport(transport)
+	}
+	transport = newRetryTransport(transport, config.Retry, config.RateLimits, config.logger())
+
+	opts := clientOpts(options.Cloud, options.CloudConfig)
+	if config.Providers != nil {
+		return config.Providers.get(options.Cloud, options.CloudConfig, config.logger(), func() (*gophercloud.ProviderClient, error) {
+			return AuthenticatedClient(opts, transport)
+		})
+	}
+	return AuthenticatedClient(opts, transport)
+}
+
+// NewExporter returns the exporter of the service name for the entry of cloud
+// in clouds.yaml, found in the standard locations. The region defaults to the
+// one of the entry, then to the one of the environment.
+func NewExporter(name, cloud, endpointType string, config ExporterConfig) (OpenStackExporter, error) {
+	cloudConfig, err := CloudsYAML{}.Cloud(cloud)
+	if err != nil {
+		return nil, err
+	}
+	if config.Region == "" && cloudConfig.RegionName == "" {
+		config.Region = os.Getenv("OS_REGION_NAME")
+	}
 
-	opts := clientconfig.ClientOpts{Cloud: cloud}
+	return New(Options{
+		ExporterConfig: config,
+		Service:        name,
+		Cloud:          cloud,
+		CloudConfig:    cloudConfig,
+		EndpointType:   endpointType,
+	})
+}
 
-	config, err := clientconfig.GetCloudFromYAML(&opts)
+// New returns the exporter of options.Service, using the registry of its
+// config or DefaultRegistry.
+func New(options Options) (OpenStackExporter, error) {
+	config := options.ExporterConfig
+	if config.Registry == nil {
+		config.Registry = DefaultRegistry
+	}
+	service, err := config.Registry.Service(options.Service)
 	if err != nil {
 		return nil, err
 	}
+	if options.CloudConfig == nil {
+		return nil, fmt.Errorf("no cloud entry given for the %s exporter", options.Service)
+	}
 
-	if !*config.Verify {
-		log.Infoln("SSL verification disabled on transport")
-		tlsConfig := &tls.Config{InsecureSkipVerify: true}
-		transport = &http.Transport{TLSClientConfig: tlsConfig}
+	// The region given in the config takes precedence over the one of the
+	// cloud entry.
+	if config.Region == "" {
+		config.Region = options.CloudConfig.RegionName
 	}
 
-	client, err := NewServiceClient(name, &opts, transport, endpointType)
+	provider, err := providerClient(options)
 	if err != nil {
 		return nil, err
 	}
 
-	switch name {
-	case "network":
-		{
-			exporter, err = NewNeutronExporter(client, prefix, disabledMetrics)
-			if err != nil {
-				return nil, err
-			}
-		}
-	case "compute":
-		{
-			exporter, err = NewNovaExporter(client, prefix, disabledMetrics)
-			if err != nil {
-				return nil, err
-			}
-		}
-	case "image":
-		{
-			exporter, err = NewGlanceExporter(client, prefix, disabledMetrics)
-			if err != nil {
-				return nil, err
-			}
-		}
-	case "volume":
-		{
-			exporter, err = NewCinderExporter(client, prefix, disabledMetrics)
-			if err != nil {
-				return nil, err
-			}
-		}
-	case "identity":
-		{
-			exporter, err = NewKeystoneExporter(client, prefix, disabledMetrics)
-			if err != nil {
-				return nil, err
-			}
-		}
-	case "object-store":
-		{
-			exporter, err = NewObjectStoreExporter(client, prefix, disabledMetrics)
-			if err != nil {
-				return nil, err
-			}
-		}
-	case "load-balancer":
-		{
-			exporter, err = NewLoadbalancerExporter(client, prefix, disabledMetrics)
-			if err != nil {
-				return nil, err
-			}
-		}
-	case "container-infra":
-		{
-			exporter, err = NewContainerInfraExporter(client, prefix, disabledMetrics)
-			if err != nil {
-				return nil, err
-			}
-		}
-	default:
-		{
-			return nil, fmt.Errorf("couldn't find a handler for %s exporter", name)
-		}
+	config.endpointOpts = gophercloud.EndpointOpts{
+		Region:       config.Region,
+		Availability: GetEndpointType(options.EndpointType),
+	}
+	config.Client, err = serviceClient(service, options.CloudConfig, provider, config.endpointOpts, config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	trackEndpoint(config.Client, options.Service)
+
+	config.Microversion, err = negotiateMicroversion(config.Client, options.Service, config.Microversion, config.logger())
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, err := service.newExporter(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.RefreshInterval > 0 {
+		exporter.StartPolling()
 	}
 
 	return exporter, nil
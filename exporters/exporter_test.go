@@ -8,9 +8,13 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"strings"
 	"testing"
 
 	"github.com/jarcoal/httpmock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -22,6 +26,8 @@ type BaseOpenStackTestSuite struct {
 	ServiceName string
 	Prefix      string
 	Exporter    *OpenStackExporter
+	// Microversion is the one the exporter of the suite is built with.
+	Microversion string
 }
 
 func (suite *BaseOpenStackTestSuite) SetResponseFromFixture(method string, statusCode int, url string, file string) {
@@ -50,24 +56,47 @@ func (suite *BaseOpenStackTestSuite) FixturePath(name string) string {
 	return fmt.Sprintf("%s/%s", baseFixturePath, name+".json")
 }
 
+// CollectAndCompare compares the metrics of the exporter under test with the
+// expected ones, leaving aside the collector durations which vary on every run.
+func (suite *BaseOpenStackTestSuite) CollectAndCompare(expected string) error {
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(*suite.Exporter); err != nil {
+		return err
+	}
+
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := registry.Gather()
+		filtered := families[:0]
+		for _, family := range families {
+			if family.GetName() != suite.Prefix+"_scrape_collector_duration_seconds" {
+				filtered = append(filtered, family)
+			}
+		}
+		return filtered, err
+	})
+	return testutil.GatherAndCompare(gatherer, strings.NewReader(expected))
+}
+
 var fixtures map[string]string = map[string]string{
-	"/container-infra/clusters":                                  "container_infra_clusters",
-	"/compute/":                                                  "nova_api_discovery",
-	"/compute/os-services":                                       "nova_os_services",
-	"/compute/os-hypervisors/detail":                             "nova_os_hypervisors",
-	"/compute/flavors/detail":                                    "nova_os_flavors",
-	"/compute/os-availability-zone":                              "nova_os_availability_zones",
-	"/compute/os-security-groups":                                "nova_os_security_groups",
-	"/compute/os-aggregates":                                     "nova_os_aggregates",
-	"/compute/limits?tenant_id=0c4e939acacf4376bdcd1129f1a054ad": "nova_os_limits",
-	"/compute/limits?tenant_id=0cbd49cbf76d405d9c86562e1d579bd3": "nova_os_limits",
-	"/compute/limits?tenant_id=2db68fed84324f29bb73130c6c2094fb": "nova_os_limits",
-	"/compute/limits?tenant_id=3d594eb0f04741069dbbb521635b21c7": "nova_os_limits",
-	"/compute/limits?tenant_id=43ebde53fc314b1c9ea2b8c5dc744927": "nova_os_limits",
-	"/compute/limits?tenant_id=4b1eb781a47440acb8af9850103e537f": "nova_os_limits",
-	"/compute/limits?tenant_id=5961c443439d4fcebe42643723755e9d": "nova_os_limits",
-	"/compute/limits?tenant_id=fdb8424c4e4f4c0ba32c52e2de3bd80e": "nova_os_limits",
-	"/compute/servers/detail?all_tenants=true":                   "nova_os_servers",
+	"/container-infra/clusters":                                         "container_infra_clusters",
+	"/compute/":                                                         "nova_api_discovery",
+	"/compute/os-services":                                              "nova_os_services",
+	"/compute/os-hypervisors/detail":                                    "nova_os_hypervisors",
+	"/compute/os-hypervisors/detail?limit=1&marker=2":                   "nova_os_hypervisors_page_2",
+	"/compute/flavors/detail":                                           "nova_os_flavors",
+	"/compute/os-availability-zone":                                     "nova_os_availability_zones",
+	"/compute/os-security-groups":                                       "nova_os_security_groups",
+	"/compute/os-aggregates":                                            "nova_os_aggregates",
+	"/compute/limits?tenant_id=0c4e939acacf4376bdcd1129f1a054ad":        "nova_os_limits",
+	"/compute/limits?tenant_id=0cbd49cbf76d405d9c86562e1d579bd3":        "nova_os_limits",
+	"/compute/limits?tenant_id=2db68fed84324f29bb73130c6c2094fb":        "nova_os_limits",
+	"/compute/limits?tenant_id=3d594eb0f04741069dbbb521635b21c7":        "nova_os_limits",
+	"/compute/limits?tenant_id=43ebde53fc314b1c9ea2b8c5dc744927":        "nova_os_limits",
+	"/compute/limits?tenant_id=4b1eb781a47440acb8af9850103e537f":        "nova_os_limits",
+	"/compute/limits?tenant_id=5961c443439d4fcebe42643723755e9d":        "nova_os_limits",
+	"/compute/limits?tenant_id=fdb8424c4e4f4c0ba32c52e2de3bd80e":        "nova_os_limits",
+	"/compute/servers/detail?all_tenants=true":                          "nova_os_servers",
+	"/compute/servers/2ce4c5b3-2866-4972-93ce-77a2ea46a7f9/diagnostics": "nova_os_server_diagnostics",
 	"/glance/":                                       "glance_api_discovery",
 	"/glance/v2/images":                              "glance_images",
 	"/identity/v3/projects":                          "identity_projects",
@@ -96,7 +125,11 @@ func (suite *BaseOpenStackTestSuite) SetupTest() {
 	suite.installFixtures()
 
 	os.Setenv("OS_CLIENT_CONFIG_FILE", path.Join(baseFixturePath, "test_config.yaml"))
-	exporter, err := NewExporter(suite.ServiceName, suite.Prefix, cloudName, []string{}, "public")
+	exporter, err := NewExporter(suite.ServiceName, cloudName, "public", ExporterConfig{
+		Prefix:          suite.Prefix,
+		DisabledMetrics: []string{},
+		Microversion:    suite.Microversion,
+	})
 	if err != nil {
 		panic(err)
 	}
@@ -109,6 +142,10 @@ func (suite *BaseOpenStackTestSuite) teardownFixtures() {
 		suite.MakeURL("/v3/auth/tokens", "35357"),
 		suite.FixturePath("tokens"),
 	)
+	suite.SetResponseFromFixture("GET", 200,
+		suite.MakeURL("/v3/auth/tokens", "35357"),
+		suite.FixturePath("tokens"),
+	)
 }
 
 func (suite *BaseOpenStackTestSuite) installFixtures() {
@@ -137,8 +174,18 @@ func (suite *BaseOpenStackTestSuite) TearDownTest() {
 
 func TestOpenStackSuites(t *testing.T) {
 	suite.Run(t, &CinderTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "volume"}})
-	suite.Run(t, &NovaTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "compute"}})
+	suite.Run(t, &NovaTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "compute", Microversion: LatestMicroversion}})
 	suite.Run(t, &NeutronTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "network"}})
 	suite.Run(t, &GlanceTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "image"}})
 	suite.Run(t, &ContainerInfraTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "container-infra"}})
+	suite.Run(t, &SnapshotTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "image"}})
+	suite.Run(t, &RegionTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "image"}})
+	suite.Run(t, &TransportTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "image"}})
+	suite.Run(t, &ProviderTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "image"}})
+	suite.Run(t, &RetryTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "image"}})
+	suite.Run(t, &MicroversionTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "compute", Microversion: LatestMicroversion}})
+	suite.Run(t, &CatalogTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "image"}})
+	suite.Run(t, &EndpointTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "image"}})
+	suite.Run(t, &RegistryTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "image"}})
+	suite.Run(t, &OptionsTestSuite{BaseOpenStackTestSuite: BaseOpenStackTestSuite{ServiceName: "image"}})
 }
@@ -0,0 +1,59 @@
+package exporters
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// A metric pattern matches the service-metric names of the metrics (i.e:
+// nova-running_vms). It is either a glob (i.e: nova-server_diagnostics_*) or,
+// when enclosed in slashes, a regular expression matching the whole name (i.e:
+// /(nova|cinder)-.*_status/).
+
+// ValidateMetricPatterns returns an error for the first invalid pattern.
+func ValidateMetricPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := matchMetric(pattern, ""); err != nil {
+			return fmt.Errorf("invalid metric pattern %q: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// ServiceMetricPattern returns the pattern matching the metrics of the exporter
+// named service (i.e: nova) matched by pattern, given without the service part.
+// A regular expression is grouped, so that its alternations stay within the
+// metrics of service.
+func ServiceMetricPattern(service, pattern string) string {
+	if isRegexPattern(pattern) {
+		return "/" + regexp.QuoteMeta(service+"-") + "(?:" + pattern[1:len(pattern)-1] + ")/"
+	}
+	return service + "-" + pattern
+}
+
+func isRegexPattern(pattern string) bool {
+	return len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/")
+}
+
+func matchMetric(pattern, name string) (bool, error) {
+	if isRegexPattern(pattern) {
+		re, err := regexp.Compile("^(?:" + pattern[1:len(pattern)-1] + ")$")
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(name), nil
+	}
+	return path.Match(pattern, name)
+}
+
+func matchAnyMetric(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		// Invalid patterns are rejected at startup by ValidateMetricPatterns.
+		if ok, _ := matchMetric(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package exporters
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricIsDisabled(t *testing.T) {
+	for _, test := range []struct {
+		disabled, enabled []string
+		metric            string
+		expected          bool
+	}{
+		{disabled: []string{"nova-flavors"}, metric: "flavors", expected: true},
+		{disabled: []string{"cinder-flavors"}, metric: "flavors", expected: false},
+		{disabled: []string{"nova-server_diagnostics_*"}, metric: "server_diagnostics_uptime", expected: true},
+		{disabled: []string{"nova-server_diagnostics_*"}, metric: "server_status", expected: false},
+		{disabled: []string{"/nova-limits_(vcpus|memory)_max/"}, metric: "limits_memory_max", expected: true},
+		{disabled: []string{"/nova-limits_(vcpus|memory)_max/"}, metric: "limits_memory_used", expected: false},
+		{disabled: []string{"/limits_.*/"}, metric: "limits_memory_used", expected: false},
+		{enabled: []string{"nova-running_vms"}, metric: "running_vms", expected: false},
+		{enabled: []string{"nova-running_vms"}, metric: "flavors", expected: true},
+		{enabled: []string{"nova-*"}, disabled: []string{"nova-flavors"}, metric: "flavors", expected: true},
+	} {
+		exporter := BaseOpenStackExporter{
+			Name:           "nova",
+			ExporterConfig: ExporterConfig{DisabledMetrics: test.disabled, EnabledMetrics: test.enabled},
+		}
+		assert.Equal(t, test.expected, exporter.MetricIsDisabled(test.metric), "%+v", test)
+	}
+}
+
+func TestGroupOwnerFiltered(t *testing.T) {
+	listServers := func(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+		exporter.EmitMetric(ch, "total_vms", prometheus.GaugeValue, 1)
+		exporter.EmitMetric(ch, "server_status", prometheus.GaugeValue, 0, "a")
+		return nil
+	}
+
+	for _, config := range []ExporterConfig{
+		{Prefix: "openstack", EnabledMetrics: []string{"test-server_status"}},
+		{Prefix: "openstack", DisabledMetrics: []string{"test-total_vms"}},
+	} {
+		exporter := BaseOpenStackExporter{Name: "test", ExporterConfig: config}
+		exporter.AddMetric("total_vms", listServers, nil, nil)
+		exporter.AddMetric("server_status", nil, []string{"id"}, nil)
+
+		err := testutil.CollectAndCompare(&exporter, strings.NewReader(`
+# HELP openstack_test_server_status server_status
+# TYPE openstack_test_server_status gauge
+openstack_test_server_status{id="a"} 0
+`), "openstack_test_server_status", "openstack_test_total_vms")
+		assert.NoError(t, err, "%+v", config)
+		assert.NotContains(t, exporter.Status().Metrics, "total_vms")
+	}
+
+	// The series of an allowlist naming only a member of a group are still
+	// collected by the ListFunc of its owner.
+	nova, err := NewNovaExporter(&ExporterConfig{EnabledMetrics: []string{"nova-server_diagnostics_*"}})
+	assert.NoError(t, err)
+	assert.NotNil(t, nova.Metrics["total_vms"].Fn)
+	assert.Contains(t, nova.Metrics, "server_diagnostics_uptime")
+	assert.NotContains(t, nova.Metrics, "running_vms")
+}
+
+func TestServiceMetricPattern(t *testing.T) {
+	assert.Equal(t, "nova-server_*", ServiceMetricPattern("nova", "server_*"))
+	assert.Equal(t, "/nova-(?:limits_.*)/", ServiceMetricPattern("nova", "/limits_.*/"))
+	assert.Equal(t, `/object_store-(?:(objects|bytes))/`, ServiceMetricPattern("object_store", "/(objects|bytes)/"))
+
+	// The alternations of a pattern don't match the metrics of other services.
+	pattern := ServiceMetricPattern("nova", "/flavors|limits_.*/")
+	for name, matched := range map[string]bool{
+		"nova-flavors":        true,
+		"nova-limits_vcpus":   true,
+		"cinder-limits_vcpus": false,
+		"cinder-flavors":      false,
+	} {
+		match, err := matchMetric(pattern, name)
+		assert.NoError(t, err)
+		assert.Equal(t, matched, match, name)
+	}
+}
+
+func TestValidateMetricPatterns(t *testing.T) {
+	assert.NoError(t, ValidateMetricPatterns([]string{"nova-*", "/nova-.*/", ""}))
+	assert.Error(t, ValidateMetricPatterns([]string{"nova-["}))
+	assert.Error(t, ValidateMetricPatterns([]string{"/nova-(/"}))
+}
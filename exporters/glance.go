@@ -1,7 +1,9 @@
 package exporters
 
 import (
-	"github.com/gophercloud/gophercloud"
+	"context"
+
+	"github.com/gophercloud/gophercloud/openstack"
 	"github.com/gophercloud/gophercloud/openstack/imageservice/v2/images"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -14,13 +16,24 @@ var defaultGlanceMetrics = []Metric{
 	{Name: "images", Fn: ListImages},
 }
 
-func NewGlanceExporter(client *gophercloud.ServiceClient, prefix string, disabledMetrics []string) (*GlanceExporter, error) {
+func init() {
+	Register(Service{
+		Type:           "image",
+		Name:           "glance",
+		DefaultEnabled: true,
+		Metrics:        defaultGlanceMetrics,
+		NewClient:      catalogClient(openstack.NewImageServiceV2),
+		NewExporter: func(config *ExporterConfig) (OpenStackExporter, error) {
+			return NewGlanceExporter(config)
+		},
+	})
+}
+
+func NewGlanceExporter(config *ExporterConfig) (*GlanceExporter, error) {
 	exporter := GlanceExporter{
 		BaseOpenStackExporter{
-			Name:            "glance",
-			Prefix:          prefix,
-			Client:          client,
-			DisabledMetrics: disabledMetrics,
+			Name:           "glance",
+			ExporterConfig: *config,
 		},
 	}
 
@@ -31,7 +44,7 @@ func NewGlanceExporter(client *gophercloud.ServiceClient, prefix string, disable
 	return &exporter, nil
 }
 
-func ListImages(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListImages(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allImages []images.Image
 
 	allPagesImage, err := images.List(exporter.Client, images.ListOpts{}).AllPages()
@@ -43,7 +56,7 @@ func ListImages(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) er
 		return err
 	}
 
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["images"].Metric,
+	exporter.EmitMetric(ch, "images",
 		prometheus.GaugeValue, float64(len(allImages)))
 
 	return nil
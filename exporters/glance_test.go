@@ -1,9 +1,6 @@
 package exporters
 
 import (
-	"strings"
-
-	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -14,20 +11,26 @@ type GlanceTestSuite struct {
 var glanceExpectedUp = `
 # HELP openstack_glance_images images
 # TYPE openstack_glance_images gauge
-openstack_glance_images 2
+openstack_glance_images{region="RegionOne"} 2
 # HELP openstack_glance_up up
 # TYPE openstack_glance_up gauge
-openstack_glance_up 1
+openstack_glance_up{region="RegionOne"} 1
+# HELP openstack_scrape_collector_success Whether the collection of a metric from the OpenStack API succeeded
+# TYPE openstack_scrape_collector_success gauge
+openstack_scrape_collector_success{collector="images",region="RegionOne",service="glance"} 1
 `
 
 var glanceExpectedDown = `
 # HELP openstack_glance_up up
 # TYPE openstack_glance_up gauge
-openstack_glance_up 0
+openstack_glance_up{region="RegionOne"} 0
+# HELP openstack_scrape_collector_success Whether the collection of a metric from the OpenStack API succeeded
+# TYPE openstack_scrape_collector_success gauge
+openstack_scrape_collector_success{collector="images",region="RegionOne",service="glance"} 0
 `
 
 func (suite *GlanceTestSuite) TestGlanceExporter() {
-	err := testutil.CollectAndCompare(*suite.Exporter, strings.NewReader(glanceExpectedUp))
+	err := suite.CollectAndCompare(glanceExpectedUp)
 	assert.NoError(suite.T(), err)
 }
 
@@ -35,6 +38,6 @@ func (suite *GlanceTestSuite) TestGlanceExporterWithEndpointDown() {
 	suite.teardownFixtures()
 	defer suite.installFixtures()
 
-	err := testutil.CollectAndCompare(*suite.Exporter, strings.NewReader(glanceExpectedDown))
+	err := suite.CollectAndCompare(glanceExpectedDown)
 	assert.NoError(suite.T(), err)
 }
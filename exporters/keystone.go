@@ -1,12 +1,17 @@
 package exporters
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
 	"github.com/gophercloud/gophercloud/openstack/identity/v3/domains"
 	"github.com/gophercloud/gophercloud/openstack/identity/v3/groups"
 	"github.com/gophercloud/gophercloud/openstack/identity/v3/projects"
 	"github.com/gophercloud/gophercloud/openstack/identity/v3/regions"
 	"github.com/gophercloud/gophercloud/openstack/identity/v3/users"
+	"github.com/gophercloud/utils/openstack/clientconfig"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -22,13 +27,36 @@ var defaultKeystoneMetrics = []Metric{
 	{Name: "regions", Fn: ListRegions},
 }
 
-func NewKeystoneExporter(client *gophercloud.ServiceClient, prefix string, disabledMetrics []string) (*KeystoneExporter, error) {
+func init() {
+	Register(Service{
+		Type:           "identity",
+		Name:           "identity",
+		DefaultEnabled: true,
+		Metrics:        defaultKeystoneMetrics,
+		NewClient:      newIdentityClient,
+		NewExporter: func(config *ExporterConfig) (OpenStackExporter, error) {
+			return NewKeystoneExporter(config)
+		},
+	})
+}
+
+// newIdentityClient returns the client of the identity API version of the
+// cloud entry, 3 by default.
+func newIdentityClient(provider *gophercloud.ProviderClient, eo gophercloud.EndpointOpts, cloud *clientconfig.Cloud) (*gophercloud.ServiceClient, error) {
+	switch cloud.IdentityAPIVersion {
+	case "v2", "2", "2.0":
+		return openstack.NewIdentityV2(provider, eo)
+	case "", "v3", "3":
+		return openstack.NewIdentityV3(provider, eo)
+	}
+	return nil, fmt.Errorf("invalid identity API version")
+}
+
+func NewKeystoneExporter(config *ExporterConfig) (*KeystoneExporter, error) {
 	exporter := KeystoneExporter{
 		BaseOpenStackExporter{
-			Name:            "identity",
-			Prefix:          prefix,
-			Client:          client,
-			DisabledMetrics: disabledMetrics,
+			Name:           "identity",
+			ExporterConfig: *config,
 		},
 	}
 
@@ -39,7 +67,7 @@ func NewKeystoneExporter(client *gophercloud.ServiceClient, prefix string, disab
 	return &exporter, nil
 }
 
-func ListDomains(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListDomains(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allDomains []domains.Domain
 
 	allPagesDomain, err := domains.List(exporter.Client, domains.ListOpts{}).AllPages()
@@ -51,32 +79,41 @@ func ListDomains(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) e
 	if err != nil {
 		return err
 	}
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["domains"].Metric,
+	exporter.EmitMetric(ch, "domains",
 		prometheus.GaugeValue, float64(len(allDomains)))
 
 	return nil
 }
 
-func ListProjects(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
-	var allProjects []projects.Project
-
-	allPagesProject, err := projects.List(exporter.Client, projects.ListOpts{}).AllPages()
+// listProjects lists the projects known by the identity client, which is shared
+// by the identity and compute exporters collected within the same scrape.
+func listProjects(ctx context.Context, client *gophercloud.ServiceClient) ([]projects.Project, error) {
+	allProjects, err := cached(ctx, client, "projects", func() (interface{}, error) {
+		allPagesProject, err := projects.List(client, projects.ListOpts{}).AllPages()
+		if err != nil {
+			return nil, err
+		}
+		return projects.ExtractProjects(allPagesProject)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return allProjects.([]projects.Project), nil
+}
 
-	allProjects, err = projects.ExtractProjects(allPagesProject)
+func ListProjects(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+	allProjects, err := listProjects(ctx, exporter.Client)
 	if err != nil {
 		return err
 	}
 
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["projects"].Metric,
+	exporter.EmitMetric(ch, "projects",
 		prometheus.GaugeValue, float64(len(allProjects)))
 
 	return nil
 }
 
-func ListRegions(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListRegions(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allRegions []regions.Region
 
 	allPagesRegion, err := regions.List(exporter.Client, regions.ListOpts{}).AllPages()
@@ -88,13 +125,13 @@ func ListRegions(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) e
 	if err != nil {
 		return err
 	}
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["regions"].Metric,
+	exporter.EmitMetric(ch, "regions",
 		prometheus.GaugeValue, float64(len(allRegions)))
 
 	return nil
 }
 
-func ListUsers(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListUsers(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allUsers []users.User
 
 	allPagesUser, err := users.List(exporter.Client, users.ListOpts{}).AllPages()
@@ -106,13 +143,13 @@ func ListUsers(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) err
 	if err != nil {
 		return err
 	}
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["users"].Metric,
+	exporter.EmitMetric(ch, "users",
 		prometheus.GaugeValue, float64(len(allUsers)))
 
 	return nil
 }
 
-func ListGroups(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListGroups(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allGroups []groups.Group
 
 	allPagesGroup, err := groups.List(exporter.Client, groups.ListOpts{}).AllPages()
@@ -125,7 +162,7 @@ func ListGroups(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) er
 		return err
 	}
 
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["groups"].Metric,
+	exporter.EmitMetric(ch, "groups",
 		prometheus.GaugeValue, float64(len(allGroups)))
 
 	return nil
@@ -0,0 +1,28 @@
+package exporters
+
+// Limiter is a counting semaphore bounding the number of ListFuncs running at
+// the same time. A nil Limiter doesn't limit anything.
+type Limiter chan struct{}
+
+// NewLimiter returns a Limiter allowing size concurrent holders, or a nil
+// Limiter when size is zero or less.
+func NewLimiter(size int) Limiter {
+	if size <= 0 {
+		return nil
+	}
+	return make(Limiter, size)
+}
+
+// Acquire blocks until a slot is available.
+func (limiter Limiter) Acquire() {
+	if limiter != nil {
+		limiter <- struct{}{}
+	}
+}
+
+// Release frees a slot taken by Acquire.
+func (limiter Limiter) Release() {
+	if limiter != nil {
+		<-limiter
+	}
+}
@@ -0,0 +1,54 @@
+package exporters
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectHonoursConcurrency(t *testing.T) {
+	var mutex sync.Mutex
+	running, maxRunning := 0, 0
+
+	fn := func(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+		return nil
+	}
+
+	for _, concurrency := range []int{1, 3} {
+		maxRunning = 0
+		exporter := BaseOpenStackExporter{
+			Name:           "test",
+			ExporterConfig: ExporterConfig{Prefix: "openstack", Concurrency: concurrency},
+		}
+		for i := 0; i < 6; i++ {
+			exporter.AddMetric(fmt.Sprintf("metric_%d", i), fn, nil, nil)
+		}
+
+		ch := make(chan prometheus.Metric)
+		go func() {
+			exporter.Collect(ch)
+			close(ch)
+		}()
+		for range ch {
+		}
+
+		assert.Equal(t, concurrency, maxRunning)
+	}
+}
@@ -1,7 +1,9 @@
 package exporters
 
 import (
-	"github.com/gophercloud/gophercloud"
+	"context"
+
+	"github.com/gophercloud/gophercloud/openstack"
 	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/amphorae"
 	"github.com/gophercloud/gophercloud/openstack/loadbalancer/v2/loadbalancers"
 	"github.com/prometheus/client_golang/prometheus"
@@ -58,13 +60,24 @@ var defaultLoadbalancerMetrics = []Metric{
 	{Name: "amphora_status", Labels: []string{"id", "loadbalancer_id", "compute_id", "status", "role", "lb_network_ip", "ha_ip"}},
 }
 
-func NewLoadbalancerExporter(client *gophercloud.ServiceClient, prefix string, disabledMetrics []string) (*LoadbalancerExporter, error) {
+func init() {
+	Register(Service{
+		Type:           "load-balancer",
+		Name:           "loadbalancer",
+		DefaultEnabled: true,
+		Metrics:        defaultLoadbalancerMetrics,
+		NewClient:      catalogClient(openstack.NewLoadBalancerV2),
+		NewExporter: func(config *ExporterConfig) (OpenStackExporter, error) {
+			return NewLoadbalancerExporter(config)
+		},
+	})
+}
+
+func NewLoadbalancerExporter(config *ExporterConfig) (*LoadbalancerExporter, error) {
 	exporter := LoadbalancerExporter{
 		BaseOpenStackExporter{
-			Name:            "loadbalancer",
-			Prefix:          prefix,
-			Client:          client,
-			DisabledMetrics: disabledMetrics,
+			Name:           "loadbalancer",
+			ExporterConfig: *config,
 		},
 	}
 	for _, metric := range defaultLoadbalancerMetrics {
@@ -73,7 +86,7 @@ func NewLoadbalancerExporter(client *gophercloud.ServiceClient, prefix string, d
 	return &exporter, nil
 }
 
-func ListAllLoadbalancers(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListAllLoadbalancers(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allLoadbalancers []loadbalancers.LoadBalancer
 	allPagesLoadbalancers, err := loadbalancers.List(exporter.Client, loadbalancers.ListOpts{}).AllPages()
 	if err != nil {
@@ -83,18 +96,18 @@ func ListAllLoadbalancers(exporter *BaseOpenStackExporter, ch chan<- prometheus.
 	if err != nil {
 		return err
 	}
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["total_loadbalancers"].Metric,
+	exporter.EmitMetric(ch, "total_loadbalancers",
 		prometheus.GaugeValue, float64(len(allLoadbalancers)))
 	// Loadbalancer status metrics
 	for _, loadbalancer := range allLoadbalancers {
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["loadbalancer_status"].Metric,
+		exporter.EmitMetric(ch, "loadbalancer_status",
 			prometheus.GaugeValue, float64(mapLoadbalancerStatus(loadbalancer.OperatingStatus)), loadbalancer.ID, loadbalancer.Name, loadbalancer.ProjectID,
 			loadbalancer.OperatingStatus, loadbalancer.ProvisioningStatus, loadbalancer.Provider, loadbalancer.VipAddress)
 	}
 	return nil
 }
 
-func ListAllAmphorae(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListAllAmphorae(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allAmphorae []amphorae.Amphora
 	allPagesAmphorae, err := amphorae.List(exporter.Client, amphorae.ListOpts{}).AllPages()
 	if err != nil {
@@ -104,11 +117,11 @@ func ListAllAmphorae(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metri
 	if err != nil {
 		return err
 	}
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["total_amphorae"].Metric,
+	exporter.EmitMetric(ch, "total_amphorae",
 		prometheus.GaugeValue, float64(len(allAmphorae)))
 	// Loadbalancer status metrics
 	for _, amphora := range allAmphorae {
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["amphora_status"].Metric,
+		exporter.EmitMetric(ch, "amphora_status",
 			prometheus.GaugeValue, float64(mapAmphoraStatus(amphora.Status)), amphora.ID, amphora.LoadbalancerID, amphora.ComputeID, amphora.Status,
 			amphora.Role, amphora.LBNetworkIP, amphora.HAIP)
 	}
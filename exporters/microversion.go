@@ -0,0 +1,218 @@
+package exporters
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/utils"
+	"github.com/prometheus/common/log"
+)
+
+// maxMicroversions are the highest microversions the ListFuncs of each service
+// are known to work with: nova 2.88 drops the resources of the hypervisors.
+// The services missing don't cap the microversion of the API.
+var maxMicroversions = map[string]string{
+	"compute": "2.87",
+	"volume":  "3.60",
+}
+
+// LatestMicroversion negotiates the highest microversion supported by both
+// the API and the exporter, which changes the labels of some metrics.
+const LatestMicroversion = "latest"
+
+// microversionServices are the services whose microversion is negotiated.
+var microversionServices = map[string]bool{
+	"compute":       true,
+	"volume":        true,
+	"load-balancer": true,
+}
+
+// versionDocument is the version discovery document served at the root of an
+// API, listing its versions, or at the root of one version.
+type versionDocument struct {
+	Version  *apiVersion  `json:"version"`
+	Versions []apiVersion `json:"versions"`
+}
+
+type apiVersion struct {
+	ID         string `json:"id"`
+	Status     string `json:"status"`
+	Version    string `json:"version"`
+	MinVersion string `json:"min_version"`
+}
+
+// maxVersion returns the highest microversion of the API version, the
+// versions without microversions (i.e: octavia) being known by their id.
+func (version apiVersion) maxVersion() string {
+	if version.Version != "" {
+		return version.Version
+	}
+	return strings.TrimPrefix(version.ID, "v")
+}
+
+// discoverMicroversion returns the highest microversion supported by the API
+// of client, from its version discovery document.
+func discoverMicroversion(client *gophercloud.ServiceClient) (string, error) {
+	root, err := utils.BaseEndpoint(client.Endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	var document versionDocument
+	_, err = client.ProviderClient.Request("GET", root, &gophercloud.RequestOpts{
+		JSONResponse: &document,
+		OkCodes:      []int{200, 300},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if document.Version != nil {
+		return document.Version.maxVersion(), nil
+	}
+
+	// The root document lists all the versions: the current one is used, or
+	// the highest when none is flagged as current.
+	var max string
+	for _, version := range document.Versions {
+		if strings.EqualFold(version.Status, "CURRENT") {
+			return version.maxVersion(), nil
+		}
+		if candidate := version.maxVersion(); compareMicroversions(candidate, max) > 0 {
+			max = candidate
+		}
+	}
+	if max == "" {
+		return "", fmt.Errorf("no version found at %s", root)
+	}
+	return max, nil
+}
+
+// ValidateMicroversion checks that microversion, if any, can be pinned for
+// service.
+func ValidateMicroversion(service, microversion string) error {
+	if microversion == "" {
+		return nil
+	}
+	if !microversionServices[service] {
+		return fmt.Errorf("the %s service has no microversion", service)
+	}
+	if microversion == LatestMicroversion {
+		return nil
+	}
+	_, _, err := parseMicroversion(microversion)
+	return err
+}
+
+// negotiateMicroversion sets the microversion of the client of service: the
+// pinned one, the highest supported by both the API and the exporter when
+// pinned is LatestMicroversion, or the base one when empty. It returns the
+// microversion used, empty meaning the base one.
+func negotiateMicroversion(client *gophercloud.ServiceClient, service, pinned string, logger log.Logger) (string, error) {
+	if err := ValidateMicroversion(service, pinned); err != nil {
+		return "", err
+	}
+	if pinned == "" || !microversionServices[service] {
+		return "", nil
+	}
+	// Only the block storage v3 API has microversions.
+	if service == "volume" && client.Type != "volumev3" {
+		if pinned != "" {
+			return "", fmt.Errorf("microversions require the volume API version 3")
+		}
+		return "", nil
+	}
+
+	microversion := pinned
+	if microversion == LatestMicroversion {
+		supported, err := discoverMicroversion(client)
+		if err != nil {
+			logger.Warnf("Cannot discover the microversion of the %s service, using its base one: %s", service, err)
+			return "", nil
+		}
+		microversion = supported
+		if max, ok := maxMicroversions[service]; ok && compareMicroversions(microversion, max) > 0 {
+			microversion = max
+		}
+	}
+	logger.Infof("Using microversion %s of the %s service", microversion, service)
+
+	switch service {
+	case "compute":
+		client.Microversion = microversion
+	case "volume":
+		// gophercloud names the microversion after the client type, which is
+		// volumev3 rather than volume.
+		client.Microversion = microversion
+		client.MoreHeaders = map[string]string{"OpenStack-API-Version": "volume " + microversion}
+	}
+	return microversion, nil
+}
+
+// parseMicroversion splits microversion into its major and minor versions.
+func parseMicroversion(microversion string) (int, int, error) {
+	parts := strings.SplitN(microversion, ".", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid microversion %q, must be MAJOR.MINOR", microversion)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid microversion %q, must be MAJOR.MINOR", microversion)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid microversion %q, must be MAJOR.MINOR", microversion)
+	}
+	return major, minor, nil
+}
+
+// compareMicroversions returns -1, 0 or 1 when a is lower than, equal to or
+// higher than b. An invalid microversion is lower than any valid one.
+func compareMicroversions(a, b string) int {
+	aMajor, aMinor, aErr := parseMicroversion(a)
+	bMajor, bMinor, bErr := parseMicroversion(b)
+	switch {
+	case aErr != nil && bErr != nil:
+		return 0
+	case aErr != nil:
+		return -1
+	case bErr != nil:
+		return 1
+	case aMajor != bMajor:
+		return sign(aMajor - bMajor)
+	}
+	return sign(aMinor - bMinor)
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// MicroversionAtLeast tells whether the API of the exporter is used at
+// microversion or a later one, so that the ListFuncs can rely on the fields it
+// adds.
+func (exporter *BaseOpenStackExporter) MicroversionAtLeast(microversion string) bool {
+	return exporter.Microversion != "" && compareMicroversions(exporter.Microversion, microversion) >= 0
+}
+
+// clientAtMost returns a copy of the client of the exporter used at
+// microversion at most, for the APIs removed by later microversions.
+func (exporter *BaseOpenStackExporter) clientAtMost(microversion string) *gophercloud.ServiceClient {
+	if !exporter.MicroversionAtLeast(microversion) {
+		return exporter.Client
+	}
+	client := *exporter.Client
+	client.Microversion = microversion
+	if _, ok := client.MoreHeaders["OpenStack-API-Version"]; ok {
+		client.MoreHeaders = map[string]string{"OpenStack-API-Version": "volume " + microversion}
+	}
+	return &client
+}
@@ -0,0 +1,126 @@
+package exporters
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type MicroversionTestSuite struct {
+	BaseOpenStackTestSuite
+}
+
+var standardDiagnostics = `{
+  "config_drive": true,
+  "cpu_details": [{"id": 0, "time": 17300000000, "utilisation": 15}],
+  "disk_details": [{"errors_count": 1, "read_bytes": 262144, "read_requests": 112, "write_bytes": 5778432, "write_requests": 488}],
+  "driver": "libvirt",
+  "memory_details": {"maximum": 512, "used": 0},
+  "nic_details": [{"mac_address": "01:23:45:67:89:ab", "rx_drop": 200, "rx_errors": 100, "rx_octets": 2070139, "rx_packets": 26701, "rx_rate": null, "tx_drop": 500, "tx_errors": 400, "tx_octets": 140208, "tx_packets": 662, "tx_rate": null}],
+  "num_cpus": 1,
+  "state": "running",
+  "uptime": 46664
+}`
+
+func (suite *MicroversionTestSuite) TestMicroversionIsNegotiated() {
+	nova := (*suite.Exporter).(*NovaExporter)
+	assert.Equal(suite.T(), "2.14", nova.Microversion)
+	assert.Equal(suite.T(), "2.14", nova.Client.Microversion)
+	assert.True(suite.T(), nova.MicroversionAtLeast("2.9"))
+	assert.False(suite.T(), nova.MicroversionAtLeast("2.47"))
+}
+
+func (suite *MicroversionTestSuite) TestBaseMicroversion() {
+	exporter, err := NewExporter(suite.ServiceName, cloudName, "public", ExporterConfig{Prefix: suite.Prefix})
+	assert.NoError(suite.T(), err)
+
+	nova := exporter.(*NovaExporter)
+	assert.Empty(suite.T(), nova.Microversion)
+	assert.Empty(suite.T(), nova.Client.Microversion)
+	assert.False(suite.T(), nova.MicroversionAtLeast("2.9"))
+}
+
+func (suite *MicroversionTestSuite) TestPinnedMicroversion() {
+	exporter, err := NewExporter(suite.ServiceName, cloudName, "public", ExporterConfig{
+		Prefix:       suite.Prefix,
+		Microversion: "2.60",
+	})
+	assert.NoError(suite.T(), err)
+
+	var mutex sync.Mutex
+	headers := make(map[string]string)
+	for path, body := range map[string]string{
+		"/compute/os-security-groups":                                       `{"security_groups": []}`,
+		"/compute/servers/2ce4c5b3-2866-4972-93ce-77a2ea46a7f9/diagnostics": standardDiagnostics,
+	} {
+		path, body := path, body
+		httpmock.RegisterResponder("GET", suite.MakeURL(path, ""), func(request *http.Request) (*http.Response, error) {
+			mutex.Lock()
+			headers[path] = request.Header.Get("X-OpenStack-Nova-API-Version")
+			mutex.Unlock()
+			response := httpmock.NewStringResponse(http.StatusOK, body)
+			response.Header = http.Header{"Content-Type": []string{"application/json"}}
+			response.Request = request
+			return response, nil
+		})
+	}
+
+	err = testutil.CollectAndCompare(exporter, strings.NewReader(`
+# HELP openstack_nova_server_diagnostics_cpu_details_time server_diagnostics_cpu_details_time
+# TYPE openstack_nova_server_diagnostics_cpu_details_time gauge
+openstack_nova_server_diagnostics_cpu_details_time{cpu_id="cpu0",hypervisor="fake-mini",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",name="new-server-test",region="RegionOne",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572"} 1.73e+10
+# HELP openstack_nova_server_diagnostics_disk_details_errors_count server_diagnostics_disk_details_errors_count
+# TYPE openstack_nova_server_diagnostics_disk_details_errors_count gauge
+openstack_nova_server_diagnostics_disk_details_errors_count{disk_id="",disk_index="0",hypervisor="fake-mini",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",name="new-server-test",region="RegionOne",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572"} 1
+# HELP openstack_nova_server_diagnostics_memory_selected_kb server_diagnostics_memory_selected_kb
+# TYPE openstack_nova_server_diagnostics_memory_selected_kb gauge
+openstack_nova_server_diagnostics_memory_selected_kb{hypervisor="fake-mini",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",name="new-server-test",region="RegionOne",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572"} 524288
+# HELP openstack_nova_server_diagnostics_nic_details_tx_octets server_diagnostics_nic_details_tx_octets
+# TYPE openstack_nova_server_diagnostics_nic_details_tx_octets gauge
+openstack_nova_server_diagnostics_nic_details_tx_octets{hypervisor="fake-mini",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",mac_address="01:23:45:67:89:ab",name="new-server-test",nic_id="",region="RegionOne",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572"} 140208
+# HELP openstack_nova_server_diagnostics_uptime server_diagnostics_uptime
+# TYPE openstack_nova_server_diagnostics_uptime gauge
+openstack_nova_server_diagnostics_uptime{hypervisor="fake-mini",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",name="new-server-test",region="RegionOne",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572"} 46664
+# HELP openstack_nova_server_status server_status
+# TYPE openstack_nova_server_status gauge
+openstack_nova_server_status{address_ipv4="1.2.3.4",address_ipv6="80fe::",availability_zone="nova",flavor_id="",flavor_name="m1.tiny",host_id="2091634baaccdc4c5a1d57069c833e402921df696b7f970791b12ec6",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",name="new-server-test",region="RegionOne",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572",user_id="fake",uuid="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9"} 0
+`),
+		"openstack_nova_server_diagnostics_cpu_details_time",
+		"openstack_nova_server_diagnostics_disk_details_errors_count",
+		"openstack_nova_server_diagnostics_memory_selected_kb",
+		"openstack_nova_server_diagnostics_nic_details_tx_octets",
+		"openstack_nova_server_diagnostics_uptime",
+		"openstack_nova_server_status",
+	)
+	assert.NoError(suite.T(), err)
+
+	// The security groups are listed at the last microversion having them.
+	assert.Equal(suite.T(), "2.35", headers["/compute/os-security-groups"])
+	assert.Equal(suite.T(), "2.60", headers["/compute/servers/2ce4c5b3-2866-4972-93ce-77a2ea46a7f9/diagnostics"])
+}
+
+func (suite *MicroversionTestSuite) TestInvalidMicroversion() {
+	for service, microversion := range map[string]string{"compute": "2", "image": LatestMicroversion} {
+		_, err := NewExporter(service, cloudName, "public", ExporterConfig{Prefix: suite.Prefix, Microversion: microversion})
+		assert.Error(suite.T(), err, service)
+	}
+}
+
+func TestCompareMicroversions(t *testing.T) {
+	for _, test := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"2.9", "2.10", -1},
+		{"2.60", "2.60", 0},
+		{"3.0", "2.87", 1},
+		{"", "2.1", -1},
+	} {
+		assert.Equal(t, test.expected, compareMicroversions(test.a, test.b), "%s %s", test.a, test.b)
+	}
+}
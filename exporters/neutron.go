@@ -1,9 +1,10 @@
 package exporters
 
 import (
+	"context"
 	"strconv"
 
-	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/agents"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/floatingips"
 	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/routers"
@@ -39,14 +40,25 @@ var defaultNeutronMetrics = []Metric{
 	{Name: "loadbalancers_not_active", Fn: ListLBsNotActive},
 }
 
+func init() {
+	Register(Service{
+		Type:           "network",
+		Name:           "neutron",
+		DefaultEnabled: true,
+		Metrics:        defaultNeutronMetrics,
+		NewClient:      catalogClient(openstack.NewNetworkV2),
+		NewExporter: func(config *ExporterConfig) (OpenStackExporter, error) {
+			return NewNeutronExporter(config)
+		},
+	})
+}
+
 // NewNeutronExporter : returns a pointer to NeutronExporter
-func NewNeutronExporter(client *gophercloud.ServiceClient, prefix string, disabledMetrics []string) (*NeutronExporter, error) {
+func NewNeutronExporter(config *ExporterConfig) (*NeutronExporter, error) {
 	exporter := NeutronExporter{
 		BaseOpenStackExporter{
-			Name:            "neutron",
-			Prefix:          prefix,
-			Client:          client,
-			DisabledMetrics: disabledMetrics,
+			Name:           "neutron",
+			ExporterConfig: *config,
 		},
 	}
 
@@ -57,35 +69,35 @@ func NewNeutronExporter(client *gophercloud.ServiceClient, prefix string, disabl
 	return &exporter, nil
 }
 
-// ListFloatingIps : count total number of instantiated FloatingIPs
-func ListFloatingIps(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
-	var allFloatingIPs []floatingips.FloatingIP
-
-	allPagesFloatingIPs, err := floatingips.List(exporter.Client, floatingips.ListOpts{}).AllPages()
+func listFloatingIPs(ctx context.Context, exporter *BaseOpenStackExporter) ([]floatingips.FloatingIP, error) {
+	allFloatingIPs, err := cached(ctx, exporter.Client, "floatingips", func() (interface{}, error) {
+		allPagesFloatingIPs, err := floatingips.List(exporter.Client, floatingips.ListOpts{}).AllPages()
+		if err != nil {
+			return nil, err
+		}
+		return floatingips.ExtractFloatingIPs(allPagesFloatingIPs)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return allFloatingIPs.([]floatingips.FloatingIP), nil
+}
 
-	allFloatingIPs, err = floatingips.ExtractFloatingIPs(allPagesFloatingIPs)
+// ListFloatingIps : count total number of instantiated FloatingIPs
+func ListFloatingIps(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+	allFloatingIPs, err := listFloatingIPs(ctx, exporter)
 	if err != nil {
 		return err
 	}
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["floating_ips"].Metric,
+	exporter.EmitMetric(ch, "floating_ips",
 		prometheus.GaugeValue, float64(len(allFloatingIPs)))
 
 	return nil
 }
 
 // ListFloatingIpsAssociatedNotActive : count total number of instantiated FloatingIPs that are associated to private IP but not in ACTIVE state
-func ListFloatingIpsAssociatedNotActive(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
-	var allFloatingIPs []floatingips.FloatingIP
-
-	allPagesFloatingIPs, err := floatingips.List(exporter.Client, floatingips.ListOpts{}).AllPages()
-	if err != nil {
-		return err
-	}
-
-	allFloatingIPs, err = floatingips.ExtractFloatingIPs(allPagesFloatingIPs)
+func ListFloatingIpsAssociatedNotActive(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+	allFloatingIPs, err := listFloatingIPs(ctx, exporter)
 	if err != nil {
 		return err
 	}
@@ -99,14 +111,14 @@ func ListFloatingIpsAssociatedNotActive(exporter *BaseOpenStackExporter, ch chan
 		}
 	}
 
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["floating_ips_associated_not_active"].Metric,
+	exporter.EmitMetric(ch, "floating_ips_associated_not_active",
 		prometheus.GaugeValue, float64(failedFIPs))
 
 	return nil
 }
 
 // ListAgentStates : list agent state per node
-func ListAgentStates(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListAgentStates(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allAgents []agents.Agent
 
 	allPagesAgents, err := agents.List(exporter.Client, agents.ListOpts{}).AllPages()
@@ -129,7 +141,7 @@ func ListAgentStates(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metri
 		if agent.AdminStateUp {
 			adminState = "up"
 		}
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["agent_state"].Metric,
+		exporter.EmitMetric(ch, "agent_state",
 			prometheus.CounterValue, float64(state), agent.Host, agent.Binary, adminState)
 	}
 
@@ -137,7 +149,7 @@ func ListAgentStates(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metri
 }
 
 // ListNetworks : Count total number of instantiated Networks
-func ListNetworks(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListNetworks(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allNetworks []networks.Network
 
 	allPagesNetworks, err := networks.List(exporter.Client, networks.ListOpts{}).AllPages()
@@ -149,14 +161,14 @@ func ListNetworks(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric)
 	if err != nil {
 		return err
 	}
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["networks"].Metric,
+	exporter.EmitMetric(ch, "networks",
 		prometheus.GaugeValue, float64(len(allNetworks)))
 
 	return nil
 }
 
 // ListSecGroups : count total number of instantiated Security Groups
-func ListSecGroups(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListSecGroups(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allSecurityGroups []groups.SecGroup
 
 	allPagesSecurityGroups, err := groups.List(exporter.Client, groups.ListOpts{}).AllPages()
@@ -168,14 +180,14 @@ func ListSecGroups(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric)
 	if err != nil {
 		return err
 	}
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["security_groups"].Metric,
+	exporter.EmitMetric(ch, "security_groups",
 		prometheus.GaugeValue, float64(len(allSecurityGroups)))
 
 	return nil
 }
 
 // ListSubnets : count total number of instantiated Subnets
-func ListSubnets(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListSubnets(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allSubnets []subnets.Subnet
 
 	allPagesSubnets, err := subnets.List(exporter.Client, subnets.ListOpts{}).AllPages()
@@ -187,14 +199,14 @@ func ListSubnets(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) e
 	if err != nil {
 		return err
 	}
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["subnets"].Metric,
+	exporter.EmitMetric(ch, "subnets",
 		prometheus.GaugeValue, float64(len(allSubnets)))
 
 	return nil
 }
 
 // ListPorts : count total number of instantiated Ports
-func ListPorts(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListPorts(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allPorts []ports.Port
 
 	allPagesPorts, err := ports.List(exporter.Client, ports.ListOpts{}).AllPages()
@@ -207,14 +219,14 @@ func ListPorts(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) err
 		return err
 	}
 
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["ports"].Metric,
+	exporter.EmitMetric(ch, "ports",
 		prometheus.GaugeValue, float64(len(allPorts)))
 
 	return nil
 }
 
 // ListPortsNoIPs : count total number of ACTIVE Ports with no IP
-func ListPortsNoIPs(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListPortsNoIPs(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allPorts []ports.Port
 	var opts = ports.ListOpts{Status: "ACTIVE"}
 
@@ -235,14 +247,14 @@ func ListPortsNoIPs(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric
 		}
 	}
 
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["ports_no_ips"].Metric,
+	exporter.EmitMetric(ch, "ports_no_ips",
 		prometheus.GaugeValue, float64(failedPorts))
 
 	return nil
 }
 
 // ListPortsLBsNotActive : count total number of LB Ports that are not in ACTIVE state
-func ListPortsLBsNotActive(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListPortsLBsNotActive(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allPorts []ports.Port
 	var opts = ports.ListOpts{DeviceOwner: "neutron:LOADBALANCERV2"}
 
@@ -263,14 +275,14 @@ func ListPortsLBsNotActive(exporter *BaseOpenStackExporter, ch chan<- prometheus
 		}
 	}
 
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["ports_lb_not_active"].Metric,
+	exporter.EmitMetric(ch, "ports_lb_not_active",
 		prometheus.GaugeValue, float64(failedPorts))
 
 	return nil
 }
 
 // ListNetworkIPAvailabilities : count total number of used IPs per Network
-func ListNetworkIPAvailabilities(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListNetworkIPAvailabilities(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allNetworkIPAvailabilities []networkipavailabilities.NetworkIPAvailability
 
 	allPagesNetworkIPAvailabilities, err := networkipavailabilities.List(exporter.Client, networkipavailabilities.ListOpts{}).AllPages()
@@ -289,7 +301,7 @@ func ListNetworkIPAvailabilities(exporter *BaseOpenStackExporter, ch chan<- prom
 			if err != nil {
 				return err
 			}
-			ch <- prometheus.MustNewConstMetric(exporter.Metrics["network_ip_availabilities_total"].Metric,
+			exporter.EmitMetric(ch, "network_ip_availabilities_total",
 				prometheus.GaugeValue, totalIPs, NetworkIPAvailabilities.NetworkID,
 				NetworkIPAvailabilities.NetworkName, strconv.Itoa(SubnetIPAvailability.IPVersion), SubnetIPAvailability.CIDR,
 				SubnetIPAvailability.SubnetName, NetworkIPAvailabilities.ProjectID)
@@ -298,7 +310,7 @@ func ListNetworkIPAvailabilities(exporter *BaseOpenStackExporter, ch chan<- prom
 			if err != nil {
 				return err
 			}
-			ch <- prometheus.MustNewConstMetric(exporter.Metrics["network_ip_availabilities_used"].Metric,
+			exporter.EmitMetric(ch, "network_ip_availabilities_used",
 				prometheus.GaugeValue, usedIPs, NetworkIPAvailabilities.NetworkID,
 				NetworkIPAvailabilities.NetworkName, strconv.Itoa(SubnetIPAvailability.IPVersion), SubnetIPAvailability.CIDR,
 				SubnetIPAvailability.SubnetName, NetworkIPAvailabilities.ProjectID)
@@ -308,36 +320,36 @@ func ListNetworkIPAvailabilities(exporter *BaseOpenStackExporter, ch chan<- prom
 	return nil
 }
 
-// ListRouters : count total number of instantiated Routers
-func ListRouters(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
-	var allRouters []routers.Router
-
-	allPagesRouters, err := routers.List(exporter.Client, routers.ListOpts{}).AllPages()
+func listRouters(ctx context.Context, exporter *BaseOpenStackExporter) ([]routers.Router, error) {
+	allRouters, err := cached(ctx, exporter.Client, "routers", func() (interface{}, error) {
+		allPagesRouters, err := routers.List(exporter.Client, routers.ListOpts{}).AllPages()
+		if err != nil {
+			return nil, err
+		}
+		return routers.ExtractRouters(allPagesRouters)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return allRouters.([]routers.Router), nil
+}
 
-	allRouters, err = routers.ExtractRouters(allPagesRouters)
+// ListRouters : count total number of instantiated Routers
+func ListRouters(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+	allRouters, err := listRouters(ctx, exporter)
 	if err != nil {
 		return err
 	}
 
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["routers"].Metric,
+	exporter.EmitMetric(ch, "routers",
 		prometheus.GaugeValue, float64(len(allRouters)))
 
 	return nil
 }
 
 // ListRoutersNotActive : count total number of instantiated Routers that are not in ACTIVE state
-func ListRoutersNotActive(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
-	var allRouters []routers.Router
-
-	allPagesRouters, err := routers.List(exporter.Client, routers.ListOpts{}).AllPages()
-	if err != nil {
-		return err
-	}
-
-	allRouters, err = routers.ExtractRouters(allPagesRouters)
+func ListRoutersNotActive(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+	allRouters, err := listRouters(ctx, exporter)
 	if err != nil {
 		return err
 	}
@@ -349,42 +361,42 @@ func ListRoutersNotActive(exporter *BaseOpenStackExporter, ch chan<- prometheus.
 		}
 	}
 
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["routers_not_active"].Metric,
+	exporter.EmitMetric(ch, "routers_not_active",
 		prometheus.GaugeValue, float64(failedRouters))
 
 	return nil
 }
 
-// ListLBs : count total number of instantiated LoadBalancers
-func ListLBs(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
-	var allLBs []loadbalancers.LoadBalancer
-
-	allPagesLBs, err := loadbalancers.List(exporter.Client, loadbalancers.ListOpts{}).AllPages()
+func listLBs(ctx context.Context, exporter *BaseOpenStackExporter) ([]loadbalancers.LoadBalancer, error) {
+	allLBs, err := cached(ctx, exporter.Client, "lbaas/loadbalancers", func() (interface{}, error) {
+		allPagesLBs, err := loadbalancers.List(exporter.Client, loadbalancers.ListOpts{}).AllPages()
+		if err != nil {
+			return nil, err
+		}
+		return loadbalancers.ExtractLoadBalancers(allPagesLBs)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return allLBs.([]loadbalancers.LoadBalancer), nil
+}
 
-	allLBs, err = loadbalancers.ExtractLoadBalancers(allPagesLBs)
+// ListLBs : count total number of instantiated LoadBalancers
+func ListLBs(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+	allLBs, err := listLBs(ctx, exporter)
 	if err != nil {
 		return err
 	}
 
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["loadbalancers"].Metric,
+	exporter.EmitMetric(ch, "loadbalancers",
 		prometheus.GaugeValue, float64(len(allLBs)))
 
 	return nil
 }
 
 // ListLBsNotActive : count total number of instantiated LoadBalancers that are not in ACTIVE state
-func ListLBsNotActive(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
-	var allLBs []loadbalancers.LoadBalancer
-
-	allPagesLBs, err := loadbalancers.List(exporter.Client, loadbalancers.ListOpts{}).AllPages()
-	if err != nil {
-		return err
-	}
-
-	allLBs, err = loadbalancers.ExtractLoadBalancers(allPagesLBs)
+func ListLBsNotActive(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+	allLBs, err := listLBs(ctx, exporter)
 	if err != nil {
 		return err
 	}
@@ -396,7 +408,7 @@ func ListLBsNotActive(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metr
 		}
 	}
 
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["loadbalancers_not_active"].Metric,
+	exporter.EmitMetric(ch, "loadbalancers_not_active",
 		prometheus.GaugeValue, float64(failedLBs))
 
 	return nil
@@ -1,11 +1,12 @@
 package exporters
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/diagnostics"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/extensions/extendedserverattributes"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/gophercloud/gophercloud"
@@ -19,6 +20,8 @@ import (
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/flavors"
 	"github.com/gophercloud/gophercloud/openstack/compute/v2/servers"
 	"github.com/gophercloud/gophercloud/openstack/identity/v3/projects"
+	"github.com/gophercloud/gophercloud/pagination"
+	"github.com/gophercloud/utils/openstack/clientconfig"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -63,26 +66,20 @@ var defaultNovaMetrics = []Metric{
 	{Name: "flavors", Fn: ListFlavors},
 	{Name: "availability_zones", Fn: ListAZs},
 	{Name: "security_groups", Fn: ListComputeSecGroups},
-	{Name: "total_vms", Fn: ListAllServers},
 	{Name: "agent_state", Labels: []string{"id", "hostname", "service", "adminState", "zone", "disabledReason"}, Fn: ListNovaAgentState},
-	{Name: "running_vms", Labels: []string{"hostname", "availability_zone", "aggregates"}, Fn: ListHypervisors},
-	{Name: "current_workload", Labels: []string{"hostname", "availability_zone", "aggregates"}},
-	{Name: "vcpus_available", Labels: []string{"hostname", "availability_zone", "aggregates"}},
-	{Name: "vcpus_used", Labels: []string{"hostname", "availability_zone", "aggregates"}},
-	{Name: "memory_available_bytes", Labels: []string{"hostname", "availability_zone", "aggregates"}},
-	{Name: "memory_used_bytes", Labels: []string{"hostname", "availability_zone", "aggregates"}},
-	{Name: "local_storage_available_bytes", Labels: []string{"hostname", "availability_zone", "aggregates"}},
-	{Name: "local_storage_used_bytes", Labels: []string{"hostname", "availability_zone", "aggregates"}},
+	{Name: "total_vms", Fn: ListAllServers},
 	{Name: "server_status", Labels: []string{"id", "status", "name", "tenant_id", "user_id", "address_ipv4",
-		"address_ipv6", "host_id", "uuid", "availability_zone", "flavor_id"}},
+		"address_ipv6", "host_id", "uuid", "availability_zone", "flavor_id", "flavor_name"}},
+	// Since microversion 2.9.
+	{Name: "server_locked", Labels: []string{"id", "name", "tenant_id"}},
 
 	{Name: "server_diagnostics_cpu_details_time", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "cpu_id"}},
 
-	{Name: "server_diagnostics_disk_details_write_bytes", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "disk_id"}},
-	{Name: "server_diagnostics_disk_details_read_bytes", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "disk_id"}},
-	{Name: "server_diagnostics_disk_details_errors_count", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "disk_id"}},
-	{Name: "server_diagnostics_disk_details_read_requests", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "disk_id"}},
-	{Name: "server_diagnostics_disk_details_write_requests", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "disk_id"}},
+	{Name: "server_diagnostics_disk_details_write_bytes", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "disk_id", "disk_index"}},
+	{Name: "server_diagnostics_disk_details_read_bytes", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "disk_id", "disk_index"}},
+	{Name: "server_diagnostics_disk_details_errors_count", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "disk_id", "disk_index"}},
+	{Name: "server_diagnostics_disk_details_read_requests", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "disk_id", "disk_index"}},
+	{Name: "server_diagnostics_disk_details_write_requests", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "disk_id", "disk_index"}},
 
 	// memory:1.048.576.e+06
 	{Name: "server_diagnostics_memory_selected_kb", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor"}},
@@ -107,31 +104,53 @@ var defaultNovaMetrics = []Metric{
 	// memory-usable:593740
 	{Name: "server_diagnostics_memory_usable_kb", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor"}},
 
-	{Name: "server_diagnostics_nic_details_rx_packets", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "nic_id"}},
-	{Name: "server_diagnostics_nic_details_rx_drop", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "nic_id"}},
-	{Name: "server_diagnostics_nic_details_tx_errors", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "nic_id"}},
-	{Name: "server_diagnostics_nic_details_rx_octets", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "nic_id"}},
-	{Name: "server_diagnostics_nic_details_rx_rate", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "nic_id"}},
-	{Name: "server_diagnostics_nic_details_rx_errors", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "nic_id"}},
-	{Name: "server_diagnostics_nic_details_tx_drop", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "nic_id"}},
-	{Name: "server_diagnostics_nic_details_tx_packets", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "nic_id"}},
-	{Name: "server_diagnostics_nic_details_tx_rate", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "nic_id"}},
+	{Name: "server_diagnostics_nic_details_rx_packets", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "nic_id", "mac_address"}},
+	{Name: "server_diagnostics_nic_details_rx_drop", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "nic_id", "mac_address"}},
+	{Name: "server_diagnostics_nic_details_tx_errors", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "nic_id", "mac_address"}},
+	{Name: "server_diagnostics_nic_details_rx_octets", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "nic_id", "mac_address"}},
+	{Name: "server_diagnostics_nic_details_rx_rate", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "nic_id", "mac_address"}},
+	{Name: "server_diagnostics_nic_details_rx_errors", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "nic_id", "mac_address"}},
+	{Name: "server_diagnostics_nic_details_tx_drop", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "nic_id", "mac_address"}},
+	{Name: "server_diagnostics_nic_details_tx_packets", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "nic_id", "mac_address"}},
+	{Name: "server_diagnostics_nic_details_tx_rate", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "nic_id", "mac_address"}},
+	// Since microversion 2.48.
+	{Name: "server_diagnostics_nic_details_tx_octets", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor", "nic_id", "mac_address"}},
 
 	{Name: "server_diagnostics_uptime", Labels: []string{"id", "status", "name", "tenant_id", "hypervisor"}},
 
+	{Name: "running_vms", Labels: []string{"hostname", "availability_zone", "aggregates"}, Fn: ListHypervisors},
+	{Name: "current_workload", Labels: []string{"hostname", "availability_zone", "aggregates"}},
+	{Name: "vcpus_available", Labels: []string{"hostname", "availability_zone", "aggregates"}},
+	{Name: "vcpus_used", Labels: []string{"hostname", "availability_zone", "aggregates"}},
+	{Name: "memory_available_bytes", Labels: []string{"hostname", "availability_zone", "aggregates"}},
+	{Name: "memory_used_bytes", Labels: []string{"hostname", "availability_zone", "aggregates"}},
+	{Name: "local_storage_available_bytes", Labels: []string{"hostname", "availability_zone", "aggregates"}},
+	{Name: "local_storage_used_bytes", Labels: []string{"hostname", "availability_zone", "aggregates"}},
+
 	{Name: "limits_vcpus_max", Labels: []string{"tenant", "tenant_id"}, Fn: ListComputeLimits},
 	{Name: "limits_vcpus_used", Labels: []string{"tenant", "tenant_id"}},
 	{Name: "limits_memory_max", Labels: []string{"tenant", "tenant_id"}},
 	{Name: "limits_memory_used", Labels: []string{"tenant", "tenant_id"}},
 }
 
-func NewNovaExporter(client *gophercloud.ServiceClient, prefix string, disabledMetrics []string) (*NovaExporter, error) {
+func init() {
+	Register(Service{
+		Type:           "compute",
+		Name:           "nova",
+		DefaultEnabled: true,
+		Metrics:        defaultNovaMetrics,
+		NewClient:      catalogClient(openstack.NewComputeV2),
+		NewExporter: func(config *ExporterConfig) (OpenStackExporter, error) {
+			return NewNovaExporter(config)
+		},
+	})
+}
+
+func NewNovaExporter(config *ExporterConfig) (*NovaExporter, error) {
 	exporter := NovaExporter{
 		BaseOpenStackExporter{
-			Name:            "nova",
-			Prefix:          prefix,
-			Client:          client,
-			DisabledMetrics: disabledMetrics,
+			Name:           "nova",
+			ExporterConfig: *config,
 		},
 	}
 	for _, metric := range defaultNovaMetrics {
@@ -141,7 +160,7 @@ func NewNovaExporter(client *gophercloud.ServiceClient, prefix string, disabledM
 	return &exporter, nil
 }
 
-func ListNovaAgentState(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListNovaAgentState(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allServices []services.Service
 
 	allPagesServices, err := services.List(exporter.Client).AllPages()
@@ -158,26 +177,21 @@ func ListNovaAgentState(exporter *BaseOpenStackExporter, ch chan<- prometheus.Me
 		if service.State == "up" {
 			state = 1
 		}
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["agent_state"].Metric,
+		exporter.EmitMetric(ch, "agent_state",
 			prometheus.CounterValue, float64(state), service.ID, service.Host, service.Binary, service.Status, service.Zone, service.DisabledReason)
 	}
 
 	return nil
 }
 
-func ListHypervisors(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
-	var allHypervisors []hypervisors.Hypervisor
+func ListHypervisors(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allAggregates []aggregates.Aggregate
 
-	allPagesHypervisors, err := hypervisors.List(exporter.Client).AllPages()
+	allHypervisors, err := listHypervisors(exporter.Client)
 	if err != nil {
 		return err
 	}
 
-	if allHypervisors, err = hypervisors.ExtractHypervisors(allPagesHypervisors); err != nil {
-		return err
-	}
-
 	allPagesAggregates, err := aggregates.List(exporter.Client).AllPages()
 	if err != nil {
 		return err
@@ -209,35 +223,82 @@ func ListHypervisors(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metri
 			availabilityZone = val
 		}
 
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["running_vms"].Metric,
+		exporter.EmitMetric(ch, "running_vms",
 			prometheus.GaugeValue, float64(hypervisor.RunningVMs), hypervisor.HypervisorHostname, availabilityZone, aggregatesLabel(hypervisor.Service.Host, hostToAggrMap))
 
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["current_workload"].Metric,
+		exporter.EmitMetric(ch, "current_workload",
 			prometheus.GaugeValue, float64(hypervisor.CurrentWorkload), hypervisor.HypervisorHostname, availabilityZone, aggregatesLabel(hypervisor.Service.Host, hostToAggrMap))
 
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["vcpus_available"].Metric,
+		exporter.EmitMetric(ch, "vcpus_available",
 			prometheus.GaugeValue, float64(hypervisor.VCPUs), hypervisor.HypervisorHostname, availabilityZone, aggregatesLabel(hypervisor.Service.Host, hostToAggrMap))
 
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["vcpus_used"].Metric,
+		exporter.EmitMetric(ch, "vcpus_used",
 			prometheus.GaugeValue, float64(hypervisor.VCPUsUsed), hypervisor.HypervisorHostname, availabilityZone, aggregatesLabel(hypervisor.Service.Host, hostToAggrMap))
 
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["memory_available_bytes"].Metric,
+		exporter.EmitMetric(ch, "memory_available_bytes",
 			prometheus.GaugeValue, float64(hypervisor.MemoryMB*MEGABYTE), hypervisor.HypervisorHostname, availabilityZone, aggregatesLabel(hypervisor.Service.Host, hostToAggrMap))
 
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["memory_used_bytes"].Metric,
+		exporter.EmitMetric(ch, "memory_used_bytes",
 			prometheus.GaugeValue, float64(hypervisor.MemoryMBUsed*MEGABYTE), hypervisor.HypervisorHostname, availabilityZone, aggregatesLabel(hypervisor.Service.Host, hostToAggrMap))
 
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["local_storage_available_bytes"].Metric,
+		exporter.EmitMetric(ch, "local_storage_available_bytes",
 			prometheus.GaugeValue, float64(hypervisor.LocalGB*GIGABYTE), hypervisor.HypervisorHostname, availabilityZone, aggregatesLabel(hypervisor.Service.Host, hostToAggrMap))
 
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["local_storage_used_bytes"].Metric,
+		exporter.EmitMetric(ch, "local_storage_used_bytes",
 			prometheus.GaugeValue, float64(hypervisor.LocalGBUsed*GIGABYTE), hypervisor.HypervisorHostname, availabilityZone, aggregatesLabel(hypervisor.Service.Host, hostToAggrMap))
 	}
 
 	return nil
 }
 
-func ListFlavors(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+// hypervisorPage is a page of the hypervisors, which are paginated from the
+// microversion 2.33 unlike the single page of hypervisors.List.
+type hypervisorPage struct {
+	pagination.LinkedPageBase
+}
+
+func (page hypervisorPage) IsEmpty() (bool, error) {
+	hypervisors, err := extractHypervisors(page)
+	return len(hypervisors) == 0, err
+}
+
+func (page hypervisorPage) NextPageURL() (string, error) {
+	var body struct {
+		Links []gophercloud.Link `json:"hypervisors_links"`
+	}
+	if err := page.ExtractInto(&body); err != nil {
+		return "", err
+	}
+	return gophercloud.ExtractNextURL(body.Links)
+}
+
+func extractHypervisors(page pagination.Page) ([]hypervisors.Hypervisor, error) {
+	var body struct {
+		Hypervisors []hypervisors.Hypervisor `json:"hypervisors"`
+	}
+	err := (page.(hypervisorPage)).ExtractInto(&body)
+	return body.Hypervisors, err
+}
+
+// listHypervisors lists the hypervisors of all the pages, following their
+// hypervisors_links.
+func listHypervisors(client *gophercloud.ServiceClient) ([]hypervisors.Hypervisor, error) {
+	var allHypervisors []hypervisors.Hypervisor
+	pager := pagination.NewPager(client, client.ServiceURL("os-hypervisors", "detail"), func(r pagination.PageResult) pagination.Page {
+		return hypervisorPage{pagination.LinkedPageBase{PageResult: r}}
+	})
+	err := pager.EachPage(func(page pagination.Page) (bool, error) {
+		hypervisors, err := extractHypervisors(page)
+		if err != nil {
+			return false, err
+		}
+		allHypervisors = append(allHypervisors, hypervisors...)
+		return true, nil
+	})
+	return allHypervisors, err
+}
+
+func ListFlavors(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allFlavors []flavors.Flavor
 
 	allPagesFlavors, err := flavors.ListDetail(exporter.Client, flavors.ListOpts{}).AllPages()
@@ -250,13 +311,13 @@ func ListFlavors(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) e
 		return err
 	}
 
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["flavors"].Metric,
+	exporter.EmitMetric(ch, "flavors",
 		prometheus.GaugeValue, float64(len(allFlavors)))
 
 	return nil
 }
 
-func ListAZs(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListAZs(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allAZs []availabilityzones.AvailabilityZone
 
 	allPagesAZs, err := availabilityzones.List(exporter.Client).AllPages()
@@ -268,16 +329,17 @@ func ListAZs(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error
 		return err
 	}
 
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["availability_zones"].Metric,
+	exporter.EmitMetric(ch, "availability_zones",
 		prometheus.GaugeValue, float64(len(allAZs)))
 
 	return nil
 }
 
-func ListComputeSecGroups(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListComputeSecGroups(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	var allSecurityGroups []secgroups.SecurityGroup
 
-	allPagesSecurityGroups, err := secgroups.List(exporter.Client).AllPages()
+	// The security groups proxy API is removed by microversion 2.36.
+	allPagesSecurityGroups, err := secgroups.List(exporter.clientAtMost("2.35")).AllPages()
 	if err != nil {
 		return err
 	}
@@ -286,17 +348,18 @@ func ListComputeSecGroups(exporter *BaseOpenStackExporter, ch chan<- prometheus.
 		return err
 	}
 
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["security_groups"].Metric,
+	exporter.EmitMetric(ch, "security_groups",
 		prometheus.GaugeValue, float64(len(allSecurityGroups)))
 
 	return nil
 }
 
-func ListAllServers(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListAllServers(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	type ServerWithExt struct {
 		servers.Server
 		availabilityzones.ServerAvailabilityZoneExt
 		extendedserverattributes.ServerAttributesExt
+		ServerLockedExt
 	}
 
 	var allServers []ServerWithExt
@@ -313,14 +376,17 @@ func ListAllServers(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric
 
 	//allServers[0]
 
-	ch <- prometheus.MustNewConstMetric(exporter.Metrics["total_vms"].Metric,
+	exporter.EmitMetric(ch, "total_vms",
 		prometheus.GaugeValue, float64(len(allServers)))
 
 	// Server status metrics
 	for _, server := range allServers {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-		ch <- prometheus.MustNewConstMetric(
-			exporter.Metrics["server_status"].Metric,
+		exporter.EmitMetric(ch,
+			"server_status",
 			prometheus.GaugeValue,
 			float64(mapServerStatus(server.Status)),
 			server.ID,
@@ -333,7 +399,13 @@ func ListAllServers(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric
 			server.HostID,
 			server.ID,
 			server.AvailabilityZone,
-			fmt.Sprintf("%v", server.Flavor["id"]))
+			stringField(server.Flavor, "id"),
+			serverFlavorName(exporter, server.Flavor))
+
+		if server.Locked != nil && exporter.MicroversionAtLeast("2.9") {
+			exporter.EmitMetric(ch, "server_locked", prometheus.GaugeValue, boolValue(*server.Locked),
+				server.ID, server.Name, server.TenantID)
+		}
 
 		//server_diagnostics_cpu_details_time
 		//map[
@@ -387,6 +459,12 @@ func ListAllServers(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric
 			continue // return err
 		}
 
+		if exporter.MicroversionAtLeast("2.48") {
+			emitServerDiagnostics(exporter, ch, diags, server.ID, server.Status, server.Name, server.TenantID,
+				server.ServerAttributesExt.HypervisorHostname)
+			continue
+		}
+
 		// todo: make this a bit more like it's made by a software engineer
 		for diagKey, diagValue := range diags {
 			var ok bool
@@ -499,28 +577,43 @@ func ListAllServers(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric
 				prometheusItemName = strings.Split(diagKey, "_")[0]
 				ok = true
 			}
-			if ok {
+			value, isFloat := diagValue.(float64)
+			if ok && isFloat {
 				if prometheusItemName == "" {
-					ch <- prometheus.MustNewConstMetric(
-						exporter.Metrics[prometheusMetricName].Metric,
+					exporter.EmitMetric(ch,
+						prometheusMetricName,
 						prometheus.GaugeValue,
-						diagValue.(float64),
+						value,
 						server.ID,
 						server.Status,
 						server.Name,
 						server.TenantID,
 						server.ServerAttributesExt.HypervisorHostname)
-				} else {
-					ch <- prometheus.MustNewConstMetric(
-						exporter.Metrics[prometheusMetricName].Metric,
+				} else if strings.HasPrefix(prometheusMetricName, "server_diagnostics_cpu_") {
+					exporter.EmitMetric(ch,
+						prometheusMetricName,
 						prometheus.GaugeValue,
-						diagValue.(float64),
+						value,
 						server.ID,
 						server.Status,
 						server.Name,
 						server.TenantID,
 						server.ServerAttributesExt.HypervisorHostname,
 						prometheusItemName)
+				} else {
+					// The disks and NICs are named by their device, the
+					// disk_index and mac_address labels being left empty.
+					exporter.EmitMetric(ch,
+						prometheusMetricName,
+						prometheus.GaugeValue,
+						value,
+						server.ID,
+						server.Status,
+						server.Name,
+						server.TenantID,
+						server.ServerAttributesExt.HypervisorHostname,
+						prometheusItemName,
+						"")
 				}
 			}
 		}
@@ -533,59 +626,152 @@ func ListAllServers(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric
 	return nil
 }
 
-func ListComputeLimits(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
-	var allProjects []projects.Project
-	var eo gophercloud.EndpointOpts
+// ServerLockedExt is the lock state of a server, given since microversion 2.9.
+type ServerLockedExt struct {
+	Locked *bool `json:"locked"`
+}
 
-	// We need a list of all tenants/projects. Therefore, within this nova exporter we need
-	// to create an openstack client for the Identity/Keystone API.
-	// If possible, use the EndpointOpts spefic to the identity service.
-	if v, ok := endpointOpts["identity"]; ok {
-		eo = v
-	} else if v, ok := endpointOpts["compute"]; ok {
-		eo = v
-	} else {
-		return errors.New("No EndpointOpts available to create Identity client")
+// serverFlavorName returns the flavor name of a server, only given from
+// microversion 2.47 on, which embeds the flavor in the server without its id.
+func serverFlavorName(exporter *BaseOpenStackExporter, flavor map[string]interface{}) string {
+	if !exporter.MicroversionAtLeast("2.47") {
+		return ""
 	}
+	return stringField(flavor, "original_name")
+}
 
-	c, err := openstack.NewIdentityV3(exporter.Client.ProviderClient, eo)
-	if err != nil {
-		return err
+// stringField returns the value of key in fields, empty when missing.
+func stringField(fields map[string]interface{}, key string) string {
+	if value, ok := fields[key]; ok && value != nil {
+		return fmt.Sprintf("%v", value)
 	}
+	return ""
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// emitServerDiagnostics emits the diagnostics of a server in the standard
+// format of microversion 2.48, labels being the ones of the server. The disks
+// and NICs have neither device nor id in this format: they are told apart by
+// the disk_index and mac_address labels, leaving disk_id and nic_id empty.
+func emitServerDiagnostics(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric, diags map[string]interface{}, labels ...string) {
+	emit := func(name string, value interface{}, item ...string) {
+		if value, ok := value.(float64); ok {
+			exporter.EmitMetric(ch, name, prometheus.GaugeValue, value, append(append([]string{}, labels...), item...)...)
+		}
+	}
+	details := func(key string) []map[string]interface{} {
+		var result []map[string]interface{}
+		if list, ok := diags[key].([]interface{}); ok {
+			for _, item := range list {
+				if detail, ok := item.(map[string]interface{}); ok {
+					result = append(result, detail)
+				}
+			}
+		}
+		return result
+	}
+
+	emit("server_diagnostics_uptime", diags["uptime"])
 
-	allPagesProject, err := projects.List(c, projects.ListOpts{}).AllPages()
+	if memory, ok := diags["memory_details"].(map[string]interface{}); ok {
+		// The maximum is given in MiB.
+		if maximum, ok := memory["maximum"].(float64); ok {
+			emit("server_diagnostics_memory_selected_kb", maximum*1024)
+		}
+	}
+
+	for _, cpu := range details("cpu_details") {
+		emit("server_diagnostics_cpu_details_time", cpu["time"], fmt.Sprintf("cpu%v", cpu["id"]))
+	}
+
+	for index, disk := range details("disk_details") {
+		id := strconv.Itoa(index)
+		emit("server_diagnostics_disk_details_read_bytes", disk["read_bytes"], "", id)
+		emit("server_diagnostics_disk_details_read_requests", disk["read_requests"], "", id)
+		emit("server_diagnostics_disk_details_write_bytes", disk["write_bytes"], "", id)
+		emit("server_diagnostics_disk_details_write_requests", disk["write_requests"], "", id)
+		emit("server_diagnostics_disk_details_errors_count", disk["errors_count"], "", id)
+	}
+
+	for _, nic := range details("nic_details") {
+		mac := stringField(nic, "mac_address")
+		for _, key := range []string{"rx_octets", "rx_packets", "rx_drop", "rx_errors", "rx_rate", "tx_octets", "tx_packets", "tx_drop", "tx_errors", "tx_rate"} {
+			emit("server_diagnostics_nic_details_"+key, nic[key], "", mac)
+		}
+	}
+}
+
+func ListComputeLimits(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+	var allProjects []projects.Project
+
+	// We need a list of all tenants/projects. Therefore, within this nova exporter we need
+	// to create an openstack client for the Identity/Keystone API, in the region
+	// of this exporter and at the endpoint of the identity service.
+	c, err := identityClient(exporter)
 	if err != nil {
 		return err
 	}
 
-	allProjects, err = projects.ExtractProjects(allPagesProject)
+	allProjects, err = listProjects(ctx, c)
 	if err != nil {
 		return err
 	}
 
 	for _, p := range allProjects {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		// Limits are obtained from the nova API, so now we can just use this exporter's client
 		limits, err := limits.Get(exporter.Client, limits.GetOpts{TenantID: p.ID}).Extract()
 		if err != nil {
 			return err
 		}
 
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["limits_vcpus_max"].Metric,
+		exporter.EmitMetric(ch, "limits_vcpus_max",
 			prometheus.GaugeValue, float64(limits.Absolute.MaxTotalCores), p.Name, p.ID)
 
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["limits_vcpus_used"].Metric,
+		exporter.EmitMetric(ch, "limits_vcpus_used",
 			prometheus.GaugeValue, float64(limits.Absolute.TotalCoresUsed), p.Name, p.ID)
 
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["limits_memory_max"].Metric,
+		exporter.EmitMetric(ch, "limits_memory_max",
 			prometheus.GaugeValue, float64(limits.Absolute.MaxTotalRAMSize), p.Name, p.ID)
 
-		ch <- prometheus.MustNewConstMetric(exporter.Metrics["limits_memory_used"].Metric,
+		exporter.EmitMetric(ch, "limits_memory_used",
 			prometheus.GaugeValue, float64(limits.Absolute.TotalRAMUsed), p.Name, p.ID)
 	}
 
 	return nil
 }
 
+// identityClient returns the client of the identity API version 3 used by
+// exporter, found with the endpoint type of the identity service or at its
+// endpoint when given.
+func identityClient(exporter *BaseOpenStackExporter) (*gophercloud.ServiceClient, error) {
+	eo := exporter.endpointOpts
+	if exporter.IdentityEndpointType != "" {
+		eo.Availability = GetEndpointType(exporter.IdentityEndpointType)
+	}
+	identity := Service{
+		Type: "identity",
+		NewClient: func(provider *gophercloud.ProviderClient, eo gophercloud.EndpointOpts, _ *clientconfig.Cloud) (*gophercloud.ServiceClient, error) {
+			return openstack.NewIdentityV3(provider, eo)
+		},
+	}
+	client, err := serviceClient(identity, nil, exporter.Client.ProviderClient, eo, exporter.IdentityEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	trackEndpoint(client, "identity")
+	return client, nil
+}
+
 // Help function to determine if this aggregate has only the 'availability_zone' metadata
 // attribute set. If so, the only purpose of the aggregate is to set the AZ for its member hosts.
 func isAzAggregate(a aggregates.Aggregate) bool {
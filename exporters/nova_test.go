@@ -1,9 +1,6 @@
 package exporters
 
 import (
-	"strings"
-
-	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -14,103 +11,168 @@ type NovaTestSuite struct {
 var novaExpectedUp = `
 # HELP openstack_nova_agent_state agent_state
 # TYPE openstack_nova_agent_state counter
-openstack_nova_agent_state{adminState="disabled",disabledReason="test1",hostname="host1",id="1",service="nova-scheduler",zone="internal"} 1
-openstack_nova_agent_state{adminState="disabled",disabledReason="test2",hostname="host1",id="2",service="nova-compute",zone="nova"} 1
-openstack_nova_agent_state{adminState="disabled",disabledReason="test4",hostname="host2",id="4",service="nova-compute",zone="nova"} 0
-openstack_nova_agent_state{adminState="enabled",disabledReason="",hostname="host2",id="3",service="nova-scheduler",zone="internal"} 0
+openstack_nova_agent_state{adminState="disabled",disabledReason="test1",hostname="host1",id="1",region="RegionOne",service="nova-scheduler",zone="internal"} 1
+openstack_nova_agent_state{adminState="disabled",disabledReason="test2",hostname="host1",id="2",region="RegionOne",service="nova-compute",zone="nova"} 1
+openstack_nova_agent_state{adminState="disabled",disabledReason="test4",hostname="host2",id="4",region="RegionOne",service="nova-compute",zone="nova"} 0
+openstack_nova_agent_state{adminState="enabled",disabledReason="",hostname="host2",id="3",region="RegionOne",service="nova-scheduler",zone="internal"} 0
 # HELP openstack_nova_availability_zones availability_zones
 # TYPE openstack_nova_availability_zones gauge
-openstack_nova_availability_zones 1
+openstack_nova_availability_zones{region="RegionOne"} 1
 # HELP openstack_nova_current_workload current_workload
 # TYPE openstack_nova_current_workload gauge
-openstack_nova_current_workload{aggregates="",availability_zone="",hostname="host1"} 0
+openstack_nova_current_workload{aggregates="",availability_zone="london",hostname="compute",region="RegionOne"} 0
+openstack_nova_current_workload{aggregates="",availability_zone="",hostname="host1",region="RegionOne"} 0
 # HELP openstack_nova_flavors flavors
 # TYPE openstack_nova_flavors gauge
-openstack_nova_flavors 7
+openstack_nova_flavors{region="RegionOne"} 7
 # HELP openstack_nova_limits_memory_max limits_memory_max
 # TYPE openstack_nova_limits_memory_max gauge
-openstack_nova_limits_memory_max{tenant="admin",tenant_id="0c4e939acacf4376bdcd1129f1a054ad"} 51200
-openstack_nova_limits_memory_max{tenant="alt_demo",tenant_id="fdb8424c4e4f4c0ba32c52e2de3bd80e"} 51200
-openstack_nova_limits_memory_max{tenant="demo",tenant_id="0cbd49cbf76d405d9c86562e1d579bd3"} 51200
-openstack_nova_limits_memory_max{tenant="invisible_to_admin",tenant_id="5961c443439d4fcebe42643723755e9d"} 51200
-openstack_nova_limits_memory_max{tenant="service",tenant_id="3d594eb0f04741069dbbb521635b21c7"} 51200
-openstack_nova_limits_memory_max{tenant="swifttenanttest1",tenant_id="43ebde53fc314b1c9ea2b8c5dc744927"} 51200
-openstack_nova_limits_memory_max{tenant="swifttenanttest2",tenant_id="2db68fed84324f29bb73130c6c2094fb"} 51200
-openstack_nova_limits_memory_max{tenant="swifttenanttest4",tenant_id="4b1eb781a47440acb8af9850103e537f"} 51200
+openstack_nova_limits_memory_max{region="RegionOne",tenant="admin",tenant_id="0c4e939acacf4376bdcd1129f1a054ad"} 51200
+openstack_nova_limits_memory_max{region="RegionOne",tenant="alt_demo",tenant_id="fdb8424c4e4f4c0ba32c52e2de3bd80e"} 51200
+openstack_nova_limits_memory_max{region="RegionOne",tenant="demo",tenant_id="0cbd49cbf76d405d9c86562e1d579bd3"} 51200
+openstack_nova_limits_memory_max{region="RegionOne",tenant="invisible_to_admin",tenant_id="5961c443439d4fcebe42643723755e9d"} 51200
+openstack_nova_limits_memory_max{region="RegionOne",tenant="service",tenant_id="3d594eb0f04741069dbbb521635b21c7"} 51200
+openstack_nova_limits_memory_max{region="RegionOne",tenant="swifttenanttest1",tenant_id="43ebde53fc314b1c9ea2b8c5dc744927"} 51200
+openstack_nova_limits_memory_max{region="RegionOne",tenant="swifttenanttest2",tenant_id="2db68fed84324f29bb73130c6c2094fb"} 51200
+openstack_nova_limits_memory_max{region="RegionOne",tenant="swifttenanttest4",tenant_id="4b1eb781a47440acb8af9850103e537f"} 51200
 # HELP openstack_nova_limits_memory_used limits_memory_used
 # TYPE openstack_nova_limits_memory_used gauge
-openstack_nova_limits_memory_used{tenant="admin",tenant_id="0c4e939acacf4376bdcd1129f1a054ad"} 0
-openstack_nova_limits_memory_used{tenant="alt_demo",tenant_id="fdb8424c4e4f4c0ba32c52e2de3bd80e"} 0
-openstack_nova_limits_memory_used{tenant="demo",tenant_id="0cbd49cbf76d405d9c86562e1d579bd3"} 0
-openstack_nova_limits_memory_used{tenant="invisible_to_admin",tenant_id="5961c443439d4fcebe42643723755e9d"} 0
-openstack_nova_limits_memory_used{tenant="service",tenant_id="3d594eb0f04741069dbbb521635b21c7"} 0
-openstack_nova_limits_memory_used{tenant="swifttenanttest1",tenant_id="43ebde53fc314b1c9ea2b8c5dc744927"} 0
-openstack_nova_limits_memory_used{tenant="swifttenanttest2",tenant_id="2db68fed84324f29bb73130c6c2094fb"} 0
-openstack_nova_limits_memory_used{tenant="swifttenanttest4",tenant_id="4b1eb781a47440acb8af9850103e537f"} 0
+openstack_nova_limits_memory_used{region="RegionOne",tenant="admin",tenant_id="0c4e939acacf4376bdcd1129f1a054ad"} 0
+openstack_nova_limits_memory_used{region="RegionOne",tenant="alt_demo",tenant_id="fdb8424c4e4f4c0ba32c52e2de3bd80e"} 0
+openstack_nova_limits_memory_used{region="RegionOne",tenant="demo",tenant_id="0cbd49cbf76d405d9c86562e1d579bd3"} 0
+openstack_nova_limits_memory_used{region="RegionOne",tenant="invisible_to_admin",tenant_id="5961c443439d4fcebe42643723755e9d"} 0
+openstack_nova_limits_memory_used{region="RegionOne",tenant="service",tenant_id="3d594eb0f04741069dbbb521635b21c7"} 0
+openstack_nova_limits_memory_used{region="RegionOne",tenant="swifttenanttest1",tenant_id="43ebde53fc314b1c9ea2b8c5dc744927"} 0
+openstack_nova_limits_memory_used{region="RegionOne",tenant="swifttenanttest2",tenant_id="2db68fed84324f29bb73130c6c2094fb"} 0
+openstack_nova_limits_memory_used{region="RegionOne",tenant="swifttenanttest4",tenant_id="4b1eb781a47440acb8af9850103e537f"} 0
 # HELP openstack_nova_limits_vcpus_max limits_vcpus_max
 # TYPE openstack_nova_limits_vcpus_max gauge
-openstack_nova_limits_vcpus_max{tenant="admin",tenant_id="0c4e939acacf4376bdcd1129f1a054ad"} 20
-openstack_nova_limits_vcpus_max{tenant="alt_demo",tenant_id="fdb8424c4e4f4c0ba32c52e2de3bd80e"} 20
-openstack_nova_limits_vcpus_max{tenant="demo",tenant_id="0cbd49cbf76d405d9c86562e1d579bd3"} 20
-openstack_nova_limits_vcpus_max{tenant="invisible_to_admin",tenant_id="5961c443439d4fcebe42643723755e9d"} 20
-openstack_nova_limits_vcpus_max{tenant="service",tenant_id="3d594eb0f04741069dbbb521635b21c7"} 20
-openstack_nova_limits_vcpus_max{tenant="swifttenanttest1",tenant_id="43ebde53fc314b1c9ea2b8c5dc744927"} 20
-openstack_nova_limits_vcpus_max{tenant="swifttenanttest2",tenant_id="2db68fed84324f29bb73130c6c2094fb"} 20
-openstack_nova_limits_vcpus_max{tenant="swifttenanttest4",tenant_id="4b1eb781a47440acb8af9850103e537f"} 20
+openstack_nova_limits_vcpus_max{region="RegionOne",tenant="admin",tenant_id="0c4e939acacf4376bdcd1129f1a054ad"} 20
+openstack_nova_limits_vcpus_max{region="RegionOne",tenant="alt_demo",tenant_id="fdb8424c4e4f4c0ba32c52e2de3bd80e"} 20
+openstack_nova_limits_vcpus_max{region="RegionOne",tenant="demo",tenant_id="0cbd49cbf76d405d9c86562e1d579bd3"} 20
+openstack_nova_limits_vcpus_max{region="RegionOne",tenant="invisible_to_admin",tenant_id="5961c443439d4fcebe42643723755e9d"} 20
+openstack_nova_limits_vcpus_max{region="RegionOne",tenant="service",tenant_id="3d594eb0f04741069dbbb521635b21c7"} 20
+openstack_nova_limits_vcpus_max{region="RegionOne",tenant="swifttenanttest1",tenant_id="43ebde53fc314b1c9ea2b8c5dc744927"} 20
+openstack_nova_limits_vcpus_max{region="RegionOne",tenant="swifttenanttest2",tenant_id="2db68fed84324f29bb73130c6c2094fb"} 20
+openstack_nova_limits_vcpus_max{region="RegionOne",tenant="swifttenanttest4",tenant_id="4b1eb781a47440acb8af9850103e537f"} 20
 # HELP openstack_nova_limits_vcpus_used limits_vcpus_used
 # TYPE openstack_nova_limits_vcpus_used gauge
-openstack_nova_limits_vcpus_used{tenant="admin",tenant_id="0c4e939acacf4376bdcd1129f1a054ad"} 0
-openstack_nova_limits_vcpus_used{tenant="alt_demo",tenant_id="fdb8424c4e4f4c0ba32c52e2de3bd80e"} 0
-openstack_nova_limits_vcpus_used{tenant="demo",tenant_id="0cbd49cbf76d405d9c86562e1d579bd3"} 0
-openstack_nova_limits_vcpus_used{tenant="invisible_to_admin",tenant_id="5961c443439d4fcebe42643723755e9d"} 0
-openstack_nova_limits_vcpus_used{tenant="service",tenant_id="3d594eb0f04741069dbbb521635b21c7"} 0
-openstack_nova_limits_vcpus_used{tenant="swifttenanttest1",tenant_id="43ebde53fc314b1c9ea2b8c5dc744927"} 0
-openstack_nova_limits_vcpus_used{tenant="swifttenanttest2",tenant_id="2db68fed84324f29bb73130c6c2094fb"} 0
-openstack_nova_limits_vcpus_used{tenant="swifttenanttest4",tenant_id="4b1eb781a47440acb8af9850103e537f"} 0
+openstack_nova_limits_vcpus_used{region="RegionOne",tenant="admin",tenant_id="0c4e939acacf4376bdcd1129f1a054ad"} 0
+openstack_nova_limits_vcpus_used{region="RegionOne",tenant="alt_demo",tenant_id="fdb8424c4e4f4c0ba32c52e2de3bd80e"} 0
+openstack_nova_limits_vcpus_used{region="RegionOne",tenant="demo",tenant_id="0cbd49cbf76d405d9c86562e1d579bd3"} 0
+openstack_nova_limits_vcpus_used{region="RegionOne",tenant="invisible_to_admin",tenant_id="5961c443439d4fcebe42643723755e9d"} 0
+openstack_nova_limits_vcpus_used{region="RegionOne",tenant="service",tenant_id="3d594eb0f04741069dbbb521635b21c7"} 0
+openstack_nova_limits_vcpus_used{region="RegionOne",tenant="swifttenanttest1",tenant_id="43ebde53fc314b1c9ea2b8c5dc744927"} 0
+openstack_nova_limits_vcpus_used{region="RegionOne",tenant="swifttenanttest2",tenant_id="2db68fed84324f29bb73130c6c2094fb"} 0
+openstack_nova_limits_vcpus_used{region="RegionOne",tenant="swifttenanttest4",tenant_id="4b1eb781a47440acb8af9850103e537f"} 0
 # HELP openstack_nova_local_storage_available_bytes local_storage_available_bytes
 # TYPE openstack_nova_local_storage_available_bytes gauge
-openstack_nova_local_storage_available_bytes{aggregates="",availability_zone="",hostname="host1"} 1.103806595072e+12
+openstack_nova_local_storage_available_bytes{aggregates="",availability_zone="london",hostname="compute",region="RegionOne"} 1.073741824e+11
+openstack_nova_local_storage_available_bytes{aggregates="",availability_zone="",hostname="host1",region="RegionOne"} 1.103806595072e+12
 # HELP openstack_nova_local_storage_used_bytes local_storage_used_bytes
 # TYPE openstack_nova_local_storage_used_bytes gauge
-openstack_nova_local_storage_used_bytes{aggregates="",availability_zone="",hostname="host1"} 0
+openstack_nova_local_storage_used_bytes{aggregates="",availability_zone="london",hostname="compute",region="RegionOne"} 1.073741824e+10
+openstack_nova_local_storage_used_bytes{aggregates="",availability_zone="",hostname="host1",region="RegionOne"} 0
 # HELP openstack_nova_memory_available_bytes memory_available_bytes
 # TYPE openstack_nova_memory_available_bytes gauge
-openstack_nova_memory_available_bytes{aggregates="",availability_zone="",hostname="host1"} 8.589934592e+09
+openstack_nova_memory_available_bytes{aggregates="",availability_zone="london",hostname="compute",region="RegionOne"} 1.7179869184e+10
+openstack_nova_memory_available_bytes{aggregates="",availability_zone="",hostname="host1",region="RegionOne"} 8.589934592e+09
 # HELP openstack_nova_memory_used_bytes memory_used_bytes
 # TYPE openstack_nova_memory_used_bytes gauge
-openstack_nova_memory_used_bytes{aggregates="",availability_zone="",hostname="host1"} 5.36870912e+08
+openstack_nova_memory_used_bytes{aggregates="",availability_zone="london",hostname="compute",region="RegionOne"} 2.147483648e+09
+openstack_nova_memory_used_bytes{aggregates="",availability_zone="",hostname="host1",region="RegionOne"} 5.36870912e+08
 # HELP openstack_nova_running_vms running_vms
 # TYPE openstack_nova_running_vms gauge
-openstack_nova_running_vms{aggregates="",availability_zone="",hostname="host1"} 0
+openstack_nova_running_vms{aggregates="",availability_zone="london",hostname="compute",region="RegionOne"} 1
+openstack_nova_running_vms{aggregates="",availability_zone="",hostname="host1",region="RegionOne"} 0
 # HELP openstack_nova_security_groups security_groups
 # TYPE openstack_nova_security_groups gauge
-openstack_nova_security_groups 1
+openstack_nova_security_groups{region="RegionOne"} 1
+# HELP openstack_nova_server_diagnostics_cpu_details_time server_diagnostics_cpu_details_time
+# TYPE openstack_nova_server_diagnostics_cpu_details_time gauge
+openstack_nova_server_diagnostics_cpu_details_time{cpu_id="cpu0",hypervisor="fake-mini",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",name="new-server-test",region="RegionOne",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572"} 1.73e+10
+# HELP openstack_nova_server_diagnostics_disk_details_errors_count server_diagnostics_disk_details_errors_count
+# TYPE openstack_nova_server_diagnostics_disk_details_errors_count gauge
+openstack_nova_server_diagnostics_disk_details_errors_count{disk_id="vda",disk_index="",hypervisor="fake-mini",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",name="new-server-test",region="RegionOne",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572"} -1
+# HELP openstack_nova_server_diagnostics_disk_details_read_bytes server_diagnostics_disk_details_read_bytes
+# TYPE openstack_nova_server_diagnostics_disk_details_read_bytes gauge
+openstack_nova_server_diagnostics_disk_details_read_bytes{disk_id="vda",disk_index="",hypervisor="fake-mini",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",name="new-server-test",region="RegionOne",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572"} 262144
+# HELP openstack_nova_server_diagnostics_disk_details_read_requests server_diagnostics_disk_details_read_requests
+# TYPE openstack_nova_server_diagnostics_disk_details_read_requests gauge
+openstack_nova_server_diagnostics_disk_details_read_requests{disk_id="vda",disk_index="",hypervisor="fake-mini",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",name="new-server-test",region="RegionOne",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572"} 112
+# HELP openstack_nova_server_diagnostics_disk_details_write_bytes server_diagnostics_disk_details_write_bytes
+# TYPE openstack_nova_server_diagnostics_disk_details_write_bytes gauge
+openstack_nova_server_diagnostics_disk_details_write_bytes{disk_id="vda",disk_index="",hypervisor="fake-mini",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",name="new-server-test",region="RegionOne",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572"} 5.778432e+06
+# HELP openstack_nova_server_diagnostics_disk_details_write_requests server_diagnostics_disk_details_write_requests
+# TYPE openstack_nova_server_diagnostics_disk_details_write_requests gauge
+openstack_nova_server_diagnostics_disk_details_write_requests{disk_id="vda",disk_index="",hypervisor="fake-mini",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",name="new-server-test",region="RegionOne",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572"} 488
+# HELP openstack_nova_server_diagnostics_memory_actual_kb server_diagnostics_memory_actual_kb
+# TYPE openstack_nova_server_diagnostics_memory_actual_kb gauge
+openstack_nova_server_diagnostics_memory_actual_kb{hypervisor="fake-mini",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",name="new-server-test",region="RegionOne",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572"} 524288
+# HELP openstack_nova_server_diagnostics_memory_selected_kb server_diagnostics_memory_selected_kb
+# TYPE openstack_nova_server_diagnostics_memory_selected_kb gauge
+openstack_nova_server_diagnostics_memory_selected_kb{hypervisor="fake-mini",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",name="new-server-test",region="RegionOne",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572"} 524288
+# HELP openstack_nova_server_diagnostics_nic_details_rx_drop server_diagnostics_nic_details_rx_drop
+# TYPE openstack_nova_server_diagnostics_nic_details_rx_drop gauge
+openstack_nova_server_diagnostics_nic_details_rx_drop{hypervisor="fake-mini",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",mac_address="",name="new-server-test",nic_id="tap1e4e1f01",region="RegionOne",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572"} 0
+# HELP openstack_nova_server_diagnostics_nic_details_rx_rate server_diagnostics_nic_details_rx_rate
+# TYPE openstack_nova_server_diagnostics_nic_details_rx_rate gauge
+openstack_nova_server_diagnostics_nic_details_rx_rate{hypervisor="fake-mini",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",mac_address="",name="new-server-test",nic_id="tap1e4e1f01",region="RegionOne",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572"} 2.070139e+06
+# HELP openstack_nova_server_diagnostics_nic_details_tx_packets server_diagnostics_nic_details_tx_packets
+# TYPE openstack_nova_server_diagnostics_nic_details_tx_packets gauge
+openstack_nova_server_diagnostics_nic_details_tx_packets{hypervisor="fake-mini",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",mac_address="",name="new-server-test",nic_id="tap1e4e1f01",region="RegionOne",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572"} 662
+# HELP openstack_nova_server_diagnostics_nic_details_tx_rate server_diagnostics_nic_details_tx_rate
+# TYPE openstack_nova_server_diagnostics_nic_details_tx_rate gauge
+openstack_nova_server_diagnostics_nic_details_tx_rate{hypervisor="fake-mini",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",mac_address="",name="new-server-test",nic_id="tap1e4e1f01",region="RegionOne",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572"} 140208
+# HELP openstack_nova_server_locked server_locked
+# TYPE openstack_nova_server_locked gauge
+openstack_nova_server_locked{id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",name="new-server-test",region="RegionOne",tenant_id="6f70656e737461636b20342065766572"} 1
 # HELP openstack_nova_server_status server_status
 # TYPE openstack_nova_server_status gauge
-openstack_nova_server_status{address_ipv4="1.2.3.4",address_ipv6="80fe::",availability_zone="nova",flavor_id="<nil>",host_id="2091634baaccdc4c5a1d57069c833e402921df696b7f970791b12ec6",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",name="new-server-test",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572",user_id="fake",uuid="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9"} 0
+openstack_nova_server_status{address_ipv4="1.2.3.4",address_ipv6="80fe::",availability_zone="nova",flavor_id="",flavor_name="",host_id="2091634baaccdc4c5a1d57069c833e402921df696b7f970791b12ec6",id="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9",name="new-server-test",region="RegionOne",status="ACTIVE",tenant_id="6f70656e737461636b20342065766572",user_id="fake",uuid="2ce4c5b3-2866-4972-93ce-77a2ea46a7f9"} 0
 # HELP openstack_nova_total_vms total_vms
 # TYPE openstack_nova_total_vms gauge
-openstack_nova_total_vms 1
+openstack_nova_total_vms{region="RegionOne"} 1
 # HELP openstack_nova_up up
 # TYPE openstack_nova_up gauge
-openstack_nova_up 1
+openstack_nova_up{region="RegionOne"} 1
 # HELP openstack_nova_vcpus_available vcpus_available
 # TYPE openstack_nova_vcpus_available gauge
-openstack_nova_vcpus_available{aggregates="",availability_zone="",hostname="host1"} 2
+openstack_nova_vcpus_available{aggregates="",availability_zone="london",hostname="compute",region="RegionOne"} 4
+openstack_nova_vcpus_available{aggregates="",availability_zone="",hostname="host1",region="RegionOne"} 2
 # HELP openstack_nova_vcpus_used vcpus_used
 # TYPE openstack_nova_vcpus_used gauge
-openstack_nova_vcpus_used{aggregates="",availability_zone="",hostname="host1"} 0
+openstack_nova_vcpus_used{aggregates="",availability_zone="london",hostname="compute",region="RegionOne"} 1
+openstack_nova_vcpus_used{aggregates="",availability_zone="",hostname="host1",region="RegionOne"} 0
+# HELP openstack_scrape_collector_success Whether the collection of a metric from the OpenStack API succeeded
+# TYPE openstack_scrape_collector_success gauge
+openstack_scrape_collector_success{collector="agent_state",region="RegionOne",service="nova"} 1
+openstack_scrape_collector_success{collector="availability_zones",region="RegionOne",service="nova"} 1
+openstack_scrape_collector_success{collector="flavors",region="RegionOne",service="nova"} 1
+openstack_scrape_collector_success{collector="limits_vcpus_max",region="RegionOne",service="nova"} 1
+openstack_scrape_collector_success{collector="running_vms",region="RegionOne",service="nova"} 1
+openstack_scrape_collector_success{collector="security_groups",region="RegionOne",service="nova"} 1
+openstack_scrape_collector_success{collector="total_vms",region="RegionOne",service="nova"} 1
 
 `
 
 var novaExpectedDown = `
 # HELP openstack_nova_up up
 # TYPE openstack_nova_up gauge
-openstack_nova_up 0
+openstack_nova_up{region="RegionOne"} 0
+# HELP openstack_scrape_collector_success Whether the collection of a metric from the OpenStack API succeeded
+# TYPE openstack_scrape_collector_success gauge
+openstack_scrape_collector_success{collector="agent_state",region="RegionOne",service="nova"} 0
+openstack_scrape_collector_success{collector="availability_zones",region="RegionOne",service="nova"} 0
+openstack_scrape_collector_success{collector="flavors",region="RegionOne",service="nova"} 0
+openstack_scrape_collector_success{collector="limits_vcpus_max",region="RegionOne",service="nova"} 0
+openstack_scrape_collector_success{collector="running_vms",region="RegionOne",service="nova"} 0
+openstack_scrape_collector_success{collector="security_groups",region="RegionOne",service="nova"} 0
+openstack_scrape_collector_success{collector="total_vms",region="RegionOne",service="nova"} 0
 `
 
 func (suite *NovaTestSuite) TestNovaExporter() {
-	err := testutil.CollectAndCompare(*suite.Exporter, strings.NewReader(novaExpectedUp))
+	err := suite.CollectAndCompare(novaExpectedUp)
 	assert.NoError(suite.T(), err)
 }
 
@@ -118,6 +180,6 @@ func (suite *NovaTestSuite) TestNovaExporterWithEndpointDown() {
 	suite.teardownFixtures()
 	defer suite.installFixtures()
 
-	err := testutil.CollectAndCompare(*suite.Exporter, strings.NewReader(novaExpectedDown))
+	err := suite.CollectAndCompare(novaExpectedDown)
 	assert.NoError(suite.T(), err)
 }
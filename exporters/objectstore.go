@@ -1,7 +1,9 @@
 package exporters
 
 import (
-	"github.com/gophercloud/gophercloud"
+	"context"
+
+	"github.com/gophercloud/gophercloud/openstack"
 	"github.com/gophercloud/gophercloud/openstack/objectstorage/v1/containers"
 	"github.com/gophercloud/gophercloud/pagination"
 	"github.com/prometheus/client_golang/prometheus"
@@ -16,13 +18,24 @@ var defaultObjectStoreMetrics = []Metric{
 	{Name: "bytes", Labels: []string{"container_name"}, Fn: nil},
 }
 
-func NewObjectStoreExporter(client *gophercloud.ServiceClient, prefix string, disabledMetrics []string) (*ObjectStoreExporter, error) {
+func init() {
+	Register(Service{
+		Type:           "object-store",
+		Name:           "object_store",
+		DefaultEnabled: true,
+		Metrics:        defaultObjectStoreMetrics,
+		NewClient:      catalogClient(openstack.NewObjectStorageV1),
+		NewExporter: func(config *ExporterConfig) (OpenStackExporter, error) {
+			return NewObjectStoreExporter(config)
+		},
+	})
+}
+
+func NewObjectStoreExporter(config *ExporterConfig) (*ObjectStoreExporter, error) {
 	exporter := ObjectStoreExporter{
 		BaseOpenStackExporter{
-			Name:            "object_store",
-			Prefix:          prefix,
-			Client:          client,
-			DisabledMetrics: disabledMetrics,
+			Name:           "object_store",
+			ExporterConfig: *config,
 		},
 	}
 
@@ -33,7 +46,7 @@ func NewObjectStoreExporter(client *gophercloud.ServiceClient, prefix string, di
 	return &exporter, nil
 }
 
-func ListContainers(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+func ListContainers(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
 	err := containers.List(exporter.Client, containers.ListOpts{Full: true}).EachPage(func(page pagination.Page) (bool, error) {
 		containerList, err := containers.ExtractInfo(page)
 		if err != nil {
@@ -41,9 +54,9 @@ func ListContainers(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric
 		}
 
 		for _, c := range containerList {
-			ch <- prometheus.MustNewConstMetric(exporter.Metrics["objects"].Metric,
+			exporter.EmitMetric(ch, "objects",
 				prometheus.GaugeValue, float64(c.Count), c.Name)
-			ch <- prometheus.MustNewConstMetric(exporter.Metrics["bytes"].Metric,
+			exporter.EmitMetric(ch, "bytes",
 				prometheus.GaugeValue, float64(c.Bytes), c.Name)
 		}
 		return true, nil
@@ -0,0 +1,95 @@
+package exporters
+
+import (
+	"bytes"
+	"net/http"
+	"path"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/stretchr/testify/assert"
+)
+
+type OptionsTestSuite struct {
+	BaseOpenStackTestSuite
+}
+
+type countingTransport struct {
+	requests int64
+}
+
+func (transport *countingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&transport.requests, 1)
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+func (suite *OptionsTestSuite) TestNewWithoutEnvironment() {
+	cloud, err := CloudsYAML{Path: path.Join(baseFixturePath, "test_config.yaml")}.Cloud(cloudName)
+	assert.NoError(suite.T(), err)
+
+	registry := NewRegistry()
+	assert.NoError(suite.T(), registry.Register(Service{Type: "image", Name: "private_glance", Metrics: defaultGlanceMetrics}))
+	providers := NewProviders(suite.Prefix)
+
+	// Two clouds built at the same time only share what they are given.
+	var wg sync.WaitGroup
+	built := make([]OpenStackExporter, 2)
+	transports := make([]*countingTransport, 2)
+	for i, name := range []string{"first", "second"} {
+		transports[i] = &countingTransport{}
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			exporter, err := New(Options{
+				ExporterConfig: ExporterConfig{
+					Prefix:    suite.Prefix,
+					Providers: providers,
+					Registry:  registry,
+					Logger:    log.NewNopLogger(),
+				},
+				Service:      "image",
+				Cloud:        name,
+				CloudConfig:  cloud,
+				EndpointType: "public",
+				Transport:    transports[i],
+			})
+			assert.NoError(suite.T(), err)
+			built[i] = exporter
+		}(i, name)
+	}
+	wg.Wait()
+
+	for i, exporter := range built {
+		assert.Equal(suite.T(), "openstack_private_glance", exporter.GetName())
+		assert.Equal(suite.T(), int64(1), atomic.LoadInt64(&transports[i].requests))
+	}
+	assert.True(suite.T(), built[0].(*BaseOpenStackExporter).Client.ProviderClient != built[1].(*BaseOpenStackExporter).Client.ProviderClient)
+
+	_, err = New(Options{ExporterConfig: ExporterConfig{Registry: registry}, Service: "compute", Cloud: "first", CloudConfig: cloud})
+	assert.EqualError(suite.T(), err, "couldn't find a handler for compute exporter")
+}
+
+func (suite *OptionsTestSuite) TestLogger() {
+	cloud, err := CloudsYAML{Path: path.Join(baseFixturePath, "test_config.yaml")}.Cloud(cloudName)
+	assert.NoError(suite.T(), err)
+
+	var logs bytes.Buffer
+	_, err = New(Options{
+		ExporterConfig: ExporterConfig{Prefix: suite.Prefix, Logger: log.NewLogger(&logs)},
+		Service:        "image",
+		Cloud:          cloudName,
+		CloudConfig:    cloud,
+	})
+	assert.NoError(suite.T(), err)
+	assert.Contains(suite.T(), logs.String(), "Adding metric: images to exporter: glance")
+}
+
+func (suite *OptionsTestSuite) TestRegisterer() {
+	registry := prometheus.NewRegistry()
+	exporter, err := EnableExporter("image", cloudName, "public", ExporterConfig{Prefix: suite.Prefix, Registerer: registry})
+	assert.NoError(suite.T(), err)
+	assert.False(suite.T(), prometheus.DefaultRegisterer.Unregister(*exporter))
+	assert.True(suite.T(), registry.Unregister(*exporter))
+}
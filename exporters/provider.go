@@ -0,0 +1,156 @@
+package exporters
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	tokens2 "github.com/gophercloud/gophercloud/openstack/identity/v2/tokens"
+	tokens3 "github.com/gophercloud/gophercloud/openstack/identity/v3/tokens"
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// Providers shares an authenticated provider client per cloud between the
+// exporters, so that they reuse the same token and re-authenticate once when
+// it expires.
+type Providers struct {
+	sync.Mutex
+	clients        map[string]*sharedProvider
+	tokenExpiry    *prometheus.GaugeVec
+	reauths        *prometheus.CounterVec
+	catalogPresent *prometheus.Desc
+}
+
+// sharedProvider is the provider client of a cloud, along with the settings of
+// the cloud entry it was authenticated with.
+type sharedProvider struct {
+	settings string
+	client   *gophercloud.ProviderClient
+}
+
+// NewProviders returns an empty set of providers, whose metrics are named with
+// prefix.
+func NewProviders(prefix string) *Providers {
+	return &Providers{
+		clients: make(map[string]*sharedProvider),
+		tokenExpiry: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(prefix, "auth", "token_expiry_timestamp_seconds"),
+			Help: "Expiry time of the token shared by the exporters of the cloud, in seconds since the epoch",
+		}, []string{"cloud"}),
+		reauths: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(prefix, "auth", "reauthentications_total"),
+			Help: "Number of times the exporters of the cloud renewed their token",
+		}, []string{"cloud"}),
+		catalogPresent: prometheus.NewDesc(
+			prometheus.BuildFQName(prefix, "catalog", "service_present"),
+			"Whether the service catalog of the cloud has an endpoint of the service in the region for the interface",
+			[]string{"cloud", "service_type", "service_name", "region", "interface"}, nil),
+	}
+}
+
+func (providers *Providers) Describe(ch chan<- *prometheus.Desc) {
+	providers.tokenExpiry.Describe(ch)
+	providers.reauths.Describe(ch)
+	ch <- providers.catalogPresent
+}
+
+func (providers *Providers) Collect(ch chan<- prometheus.Metric) {
+	providers.tokenExpiry.Collect(ch)
+	providers.reauths.Collect(ch)
+
+	// The catalog is the one of the current token of each cloud.
+	providers.Lock()
+	defer providers.Unlock()
+	for cloud, shared := range providers.clients {
+		endpoints, err := catalogEndpoints(shared.client)
+		if err != nil {
+			log.Debugf("Cannot read the service catalog of cloud %s: %s", cloud, err)
+			continue
+		}
+		seen := make(map[CatalogEndpoint]bool)
+		for _, endpoint := range endpoints {
+			if seen[endpoint] {
+				continue
+			}
+			seen[endpoint] = true
+			ch <- prometheus.MustNewConstMetric(providers.catalogPresent, prometheus.GaugeValue, 1,
+				cloud, endpoint.ServiceType, endpoint.ServiceName, endpoint.Region, endpoint.Interface)
+		}
+	}
+}
+
+// get returns the provider client of cloud, authenticating with authenticate
+// when there is none yet or when the cloud entry changed since.
+func (providers *Providers) get(cloud string, entry *clientconfig.Cloud, logger log.Logger, authenticate func() (*gophercloud.ProviderClient, error)) (*gophercloud.ProviderClient, error) {
+	settings, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	// Authenticating while holding the lock makes the exporters of a cloud
+	// enabled at the same time wait for a single token.
+	providers.Lock()
+	defer providers.Unlock()
+
+	if shared, ok := providers.clients[cloud]; ok && shared.settings == string(settings) {
+		return shared.client, nil
+	}
+
+	client, err := authenticate()
+	if err != nil {
+		return nil, err
+	}
+	providers.clients[cloud] = &sharedProvider{settings: string(settings), client: client}
+	providers.recordExpiry(cloud, client)
+
+	if reauth := client.ReauthFunc; reauth != nil {
+		client.ReauthFunc = func() error {
+			if err := reauth(); err != nil {
+				return err
+			}
+			logger.Infof("Renewed the token of cloud: %s", cloud)
+			providers.reauths.WithLabelValues(cloud).Inc()
+			providers.recordExpiry(cloud, client)
+			return nil
+		}
+	}
+	return client, nil
+}
+
+func (providers *Providers) recordExpiry(cloud string, client *gophercloud.ProviderClient) {
+	if expiry, ok := tokenExpiry(client); ok {
+		providers.tokenExpiry.WithLabelValues(cloud).Set(float64(expiry.Unix()))
+	}
+}
+
+// tokenExpiry returns the expiry time of the token of client, if known.
+func tokenExpiry(client *gophercloud.ProviderClient) (time.Time, bool) {
+	var expiresAt time.Time
+	var err error
+	switch result := client.GetAuthResult().(type) {
+	case tokens3.CreateResult:
+		var token *tokens3.Token
+		if token, err = result.ExtractToken(); err == nil {
+			expiresAt = token.ExpiresAt
+		}
+	case tokens3.GetResult:
+		var token *tokens3.Token
+		if token, err = result.ExtractToken(); err == nil {
+			expiresAt = token.ExpiresAt
+		}
+	case tokens2.CreateResult:
+		var token *tokens2.Token
+		if token, err = result.ExtractToken(); err == nil {
+			expiresAt = token.ExpiresAt
+		}
+	default:
+		return time.Time{}, false
+	}
+	if err != nil || expiresAt.IsZero() {
+		return time.Time{}, false
+	}
+	return expiresAt, true
+}
@@ -0,0 +1,49 @@
+package exporters
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type ProviderTestSuite struct {
+	BaseOpenStackTestSuite
+}
+
+func (suite *ProviderTestSuite) TestProviderIsShared() {
+	tokenURL := "POST " + suite.MakeURL("/v3/auth/tokens", "35357")
+	calls := httpmock.GetCallCountInfo()[tokenURL]
+	providers := NewProviders(suite.Prefix)
+
+	var clients []OpenStackExporter
+	for _, service := range []string{"image", "compute", "network"} {
+		exporter, err := NewExporter(service, cloudName, "public", ExporterConfig{Prefix: suite.Prefix, Providers: providers})
+		assert.NoError(suite.T(), err)
+		clients = append(clients, exporter)
+	}
+	glance := clients[0].(*GlanceExporter)
+	nova := clients[1].(*NovaExporter)
+	assert.Equal(suite.T(), glance.Client.ProviderClient, nova.Client.ProviderClient)
+
+	assert.Equal(suite.T(), calls+1, httpmock.GetCallCountInfo()[tokenURL])
+
+	// Renewing the token through any of the exporters renews it for all.
+	assert.NoError(suite.T(), nova.Client.ProviderClient.Reauthenticate(""))
+	assert.Equal(suite.T(), calls+2, httpmock.GetCallCountInfo()[tokenURL])
+
+	expiry, err := time.Parse(time.RFC3339, "2100-11-07T02:58:43.578887Z")
+	assert.NoError(suite.T(), err)
+	err = testutil.CollectAndCompare(providers, strings.NewReader(fmt.Sprintf(`
+# HELP openstack_auth_reauthentications_total Number of times the exporters of the cloud renewed their token
+# TYPE openstack_auth_reauthentications_total counter
+openstack_auth_reauthentications_total{cloud="test.cloud"} 1
+# HELP openstack_auth_token_expiry_timestamp_seconds Expiry time of the token shared by the exporters of the cloud, in seconds since the epoch
+# TYPE openstack_auth_token_expiry_timestamp_seconds gauge
+openstack_auth_token_expiry_timestamp_seconds{cloud="test.cloud"} %d
+`, expiry.Unix())), "openstack_auth_reauthentications_total", "openstack_auth_token_expiry_timestamp_seconds")
+	assert.NoError(suite.T(), err)
+}
@@ -0,0 +1,45 @@
+package exporters
+
+import (
+	"path"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type RegionTestSuite struct {
+	BaseOpenStackTestSuite
+}
+
+func (suite *RegionTestSuite) TestCatalogRegions() {
+	cloud, err := CloudsYAML{Path: path.Join(baseFixturePath, "test_config.yaml")}.Cloud(cloudName)
+	assert.NoError(suite.T(), err)
+
+	catalog, err := ServiceCatalog(Options{
+		ExporterConfig: ExporterConfig{Providers: NewProviders(suite.Prefix)},
+		Cloud:          cloudName,
+		CloudConfig:    cloud,
+	})
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), []string{"RegionOne"}, catalog.Regions())
+}
+
+func (suite *RegionTestSuite) TestRegionLabel() {
+	exporter, err := NewExporter(suite.ServiceName, cloudName, "public", ExporterConfig{
+		Prefix: suite.Prefix,
+		Region: "RegionOne",
+	})
+	assert.NoError(suite.T(), err)
+
+	err = testutil.CollectAndCompare(exporter, strings.NewReader(glanceExpectedUp), "openstack_glance_images", "openstack_glance_up", "openstack_scrape_collector_success")
+	assert.NoError(suite.T(), err)
+}
+
+func (suite *RegionTestSuite) TestUnknownRegion() {
+	_, err := NewExporter(suite.ServiceName, cloudName, "public", ExporterConfig{
+		Prefix: suite.Prefix,
+		Region: "RegionTwo",
+	})
+	assert.Error(suite.T(), err)
+}
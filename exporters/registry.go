@@ -0,0 +1,138 @@
+package exporters
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/utils/openstack/clientconfig"
+)
+
+// Service describes the exporter of an OpenStack service. The built-in
+// exporters register theirs in DefaultRegistry, and so can the packages linked
+// with the exporter for the services it doesn't know about.
+type Service struct {
+	// Type is the type of the service in the service catalog, which names the
+	// service in the flags and the configuration file.
+	Type string
+	// Name is the name of the exporter, which is the subsystem of its metrics
+	// and the prefix of its metric patterns.
+	Name string
+	// DefaultEnabled tells whether the exporter runs unless disabled.
+	DefaultEnabled bool
+	// Metrics are the metrics collected by default.
+	Metrics []Metric
+	// NewClient returns the client of the service at the endpoint found by eo.
+	// When nil, the client has the endpoint of Type found in the catalog.
+	NewClient func(provider *gophercloud.ProviderClient, eo gophercloud.EndpointOpts, cloud *clientconfig.Cloud) (*gophercloud.ServiceClient, error)
+	// NewExporter returns the exporter of the service using config.Client.
+	// When nil, the exporter collects Metrics.
+	NewExporter func(config *ExporterConfig) (OpenStackExporter, error)
+}
+
+// Registry holds the services the exporters can be built for.
+type Registry struct {
+	sync.RWMutex
+	services map[string]Service
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{services: make(map[string]Service)}
+}
+
+// DefaultRegistry holds the built-in services and the ones registered by the
+// packages linked with the exporter.
+var DefaultRegistry = NewRegistry()
+
+// Register adds service to DefaultRegistry, it is meant to be called from the
+// init function of the package of the exporter and panics on failure.
+func Register(service Service) {
+	if err := DefaultRegistry.Register(service); err != nil {
+		panic(err)
+	}
+}
+
+// Register adds service to the registry.
+func (registry *Registry) Register(service Service) error {
+	if service.Type == "" || service.Name == "" {
+		return fmt.Errorf("a service must have a type and a name")
+	}
+	if service.NewExporter == nil && len(service.Metrics) == 0 {
+		return fmt.Errorf("service %s has neither metrics nor exporter", service.Type)
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := registry.services[service.Type]; ok {
+		return fmt.Errorf("service %s is already registered", service.Type)
+	}
+	registry.services[service.Type] = service
+	return nil
+}
+
+// Service returns the registered service of type serviceType.
+func (registry *Registry) Service(serviceType string) (Service, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	service, ok := registry.services[serviceType]
+	if !ok {
+		return Service{}, fmt.Errorf("couldn't find a handler for %s exporter", serviceType)
+	}
+	return service, nil
+}
+
+// Types returns the types of the registered services, sorted.
+func (registry *Registry) Types() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	var types []string
+	for serviceType := range registry.services {
+		types = append(types, serviceType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// newClient returns the client of service using the authenticated provider
+// client, at the endpoint found by eo.
+func (service Service) newClient(provider *gophercloud.ProviderClient, eo gophercloud.EndpointOpts, cloud *clientconfig.Cloud) (*gophercloud.ServiceClient, error) {
+	if service.NewClient != nil {
+		return service.NewClient(provider, eo, cloud)
+	}
+
+	eo.ApplyDefaults(service.Type)
+	url, err := provider.EndpointLocator(eo)
+	if err != nil {
+		return nil, err
+	}
+	return &gophercloud.ServiceClient{ProviderClient: provider, Endpoint: url, Type: service.Type}, nil
+}
+
+// newExporter returns the exporter of service using config.Client.
+func (service Service) newExporter(config *ExporterConfig) (OpenStackExporter, error) {
+	if service.NewExporter != nil {
+		return service.NewExporter(config)
+	}
+
+	exporter := BaseOpenStackExporter{
+		Name:           service.Name,
+		ExporterConfig: *config,
+	}
+	for _, metric := range service.Metrics {
+		exporter.AddMetric(metric.Name, metric.Fn, metric.Labels, nil)
+	}
+	return &exporter, nil
+}
+
+// catalogClient adapts a gophercloud client constructor to Service.NewClient,
+// for the services whose client doesn't depend on the cloud entry.
+func catalogClient(newClient func(*gophercloud.ProviderClient, gophercloud.EndpointOpts) (*gophercloud.ServiceClient, error)) func(*gophercloud.ProviderClient, gophercloud.EndpointOpts, *clientconfig.Cloud) (*gophercloud.ServiceClient, error) {
+	return func(provider *gophercloud.ProviderClient, eo gophercloud.EndpointOpts, _ *clientconfig.Cloud) (*gophercloud.ServiceClient, error) {
+		return newClient(provider, eo)
+	}
+}
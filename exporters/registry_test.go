@@ -0,0 +1,60 @@
+package exporters
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/stretchr/testify/assert"
+)
+
+type RegistryTestSuite struct {
+	BaseOpenStackTestSuite
+}
+
+func (suite *RegistryTestSuite) TestRegisteredService() {
+	// An exporter of an in-house service, built from its metrics only.
+	assert.NoError(suite.T(), DefaultRegistry.Register(Service{
+		Type:      "private-image",
+		Name:      "private_image",
+		NewClient: catalogClient(openstack.NewImageServiceV2),
+		Metrics:   []Metric{{Name: "images", Fn: ListImages}},
+	}))
+	defer func() {
+		DefaultRegistry.Lock()
+		delete(DefaultRegistry.services, "private-image")
+		DefaultRegistry.Unlock()
+	}()
+
+	exporter, err := NewExporter("private-image", cloudName, "public", ExporterConfig{Prefix: suite.Prefix})
+	assert.NoError(suite.T(), err)
+
+	suite.Exporter = &exporter
+	assert.NoError(suite.T(), suite.CollectAndCompare(`
+# HELP openstack_private_image_images images
+# TYPE openstack_private_image_images gauge
+openstack_private_image_images{region="RegionOne"} 2
+# HELP openstack_private_image_up up
+# TYPE openstack_private_image_up gauge
+openstack_private_image_up{region="RegionOne"} 1
+# HELP openstack_scrape_collector_success Whether the collection of a metric from the OpenStack API succeeded
+# TYPE openstack_scrape_collector_success gauge
+openstack_scrape_collector_success{collector="images",region="RegionOne",service="private_image"} 1
+`))
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	assert.NoError(t, registry.Register(Service{Type: "image", Name: "glance", Metrics: defaultGlanceMetrics}))
+	assert.NoError(t, registry.Register(Service{Type: "compute", Name: "nova", Metrics: defaultNovaMetrics}))
+
+	assert.EqualError(t, registry.Register(Service{Type: "image", Name: "glance", Metrics: defaultGlanceMetrics}), "service image is already registered")
+	assert.EqualError(t, registry.Register(Service{Type: "dns", Metrics: defaultGlanceMetrics}), "a service must have a type and a name")
+	assert.EqualError(t, registry.Register(Service{Type: "dns", Name: "designate"}), "service dns has neither metrics nor exporter")
+
+	assert.Equal(t, []string{"compute", "image"}, registry.Types())
+	service, err := registry.Service("image")
+	assert.NoError(t, err)
+	assert.Equal(t, "glance", service.Name)
+	_, err = registry.Service("dns")
+	assert.EqualError(t, err, "couldn't find a handler for dns exporter")
+}
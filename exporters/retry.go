@@ -0,0 +1,217 @@
+package exporters
+
+import (
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+// RetryPolicy is how the idempotent requests sent to the OpenStack APIs are
+// retried when the API is unavailable or throttles them.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries of a request, zero disables them.
+	MaxRetries int
+	// Backoff is the delay before the first retry, doubled after each one.
+	Backoff time.Duration
+	// MaxBackoff caps the delay between two attempts, including the one asked
+	// by a Retry-After header.
+	MaxBackoff time.Duration
+}
+
+// RateLimits are token buckets limiting the rate of the requests sent to each
+// API endpoint, shared by all the exporters. A nil RateLimits doesn't limit
+// anything.
+type RateLimits struct {
+	rate  float64
+	burst int
+
+	sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// NewRateLimits returns the limits allowing rate requests per second to each
+// endpoint, with bursts of up to burst requests, or nil when rate is zero or
+// less.
+func NewRateLimits(rate float64, burst int) *RateLimits {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimits{rate: rate, burst: burst, buckets: make(map[string]*tokenBucket)}
+}
+
+// reserve takes a token from the bucket of endpoint and returns how long to
+// wait before using it.
+func (limits *RateLimits) reserve(endpoint string) time.Duration {
+	if limits == nil {
+		return 0
+	}
+
+	limits.Lock()
+	defer limits.Unlock()
+
+	bucket, ok := limits.buckets[endpoint]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limits.burst), last: time.Now()}
+		limits.buckets[endpoint] = bucket
+	}
+	return bucket.take(limits.rate, limits.burst)
+}
+
+// tokenBucket holds the tokens of an endpoint. The tokens go negative when
+// the requests waiting for them outnumber the burst.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (bucket *tokenBucket) take(rate float64, burst int) time.Duration {
+	now := time.Now()
+	bucket.tokens += now.Sub(bucket.last).Seconds() * rate
+	if bucket.tokens > float64(burst) {
+		bucket.tokens = float64(burst)
+	}
+	bucket.last = now
+
+	bucket.tokens--
+	if bucket.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-bucket.tokens / rate * float64(time.Second))
+}
+
+// retryTransport sends the requests through next, nil meaning
+// http.DefaultTransport, within the rate limits of their endpoint, and retries
+// the idempotent ones according to policy.
+type retryTransport struct {
+	next   http.RoundTripper
+	policy RetryPolicy
+	limits *RateLimits
+	logger log.Logger
+}
+
+// newRetryTransport returns next wrapped in a retryTransport, unless neither
+// retries nor rate limits are set.
+func newRetryTransport(next http.RoundTripper, policy RetryPolicy, limits *RateLimits, logger log.Logger) http.RoundTripper {
+	if policy.MaxRetries <= 0 && limits == nil {
+		return next
+	}
+	return &retryTransport{next: next, policy: policy, limits: limits, logger: logger}
+}
+
+func (transport *retryTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	next := transport.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	backoff := transport.policy.Backoff
+	for attempt := 0; ; attempt++ {
+		if err := sleep(request, transport.limits.reserve(request.URL.Scheme+"://"+request.URL.Host)); err != nil {
+			return nil, err
+		}
+
+		response, err := next.RoundTrip(request)
+		if attempt >= transport.policy.MaxRetries || !retryable(request, response, err) {
+			return response, err
+		}
+
+		delay := jitter(backoff)
+		if response != nil {
+			if after, ok := retryAfter(response); ok {
+				delay = after
+			}
+			// Reuse the connection for the next attempt.
+			io.Copy(ioutil.Discard, response.Body) // nolint: errcheck
+			response.Body.Close()
+		}
+		if max := transport.policy.MaxBackoff; max > 0 && delay > max {
+			delay = max
+		}
+		transport.logger.Debugf("Retrying %s %s in %s: %s", request.Method, request.URL, delay, failure(response, err))
+
+		if err := sleep(request, delay); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+// retryable tells whether the outcome of request is worth retrying: only the
+// idempotent requests which failed to get a response, were throttled or met an
+// unavailable API are.
+func retryable(request *http.Request, response *http.Response, err error) bool {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		return false
+	}
+	if request.Body != nil && request.Body != http.NoBody {
+		return false
+	}
+	if err != nil {
+		return request.Context().Err() == nil
+	}
+	switch response.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the delay asked by the Retry-After header of response,
+// given in seconds or as a date.
+func retryAfter(response *http.Response) (time.Duration, bool) {
+	value := response.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// jitter returns a random delay between half of backoff and backoff, so that
+// the exporters failing together don't retry together.
+func jitter(backoff time.Duration) time.Duration {
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// sleep waits for delay, or until the request is cancelled.
+func sleep(request *http.Request, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-request.Context().Done():
+		return request.Context().Err()
+	}
+}
+
+func failure(response *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return response.Status
+}
@@ -0,0 +1,112 @@
+package exporters
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type RetryTestSuite struct {
+	BaseOpenStackTestSuite
+}
+
+func (suite *RetryTestSuite) TestUnavailableAPIIsRetried() {
+	metrics := NewAPIMetrics(suite.Prefix)
+	exporter, err := NewExporter(suite.ServiceName, cloudName, "public", ExporterConfig{
+		Prefix:     suite.Prefix,
+		Retry:      RetryPolicy{MaxRetries: 2, Backoff: time.Millisecond},
+		APIMetrics: metrics,
+	})
+	assert.NoError(suite.T(), err)
+
+	url := suite.MakeURL("/glance/v2/images", "")
+	images, err := ioutil.ReadFile(suite.FixturePath("glance_images"))
+	assert.NoError(suite.T(), err)
+	attempts := 0
+	httpmock.RegisterResponder("GET", url, func(request *http.Request) (*http.Response, error) {
+		attempts++
+		switch attempts {
+		case 1:
+			response := httpmock.NewStringResponse(http.StatusServiceUnavailable, "")
+			response.Header = http.Header{"Retry-After": []string{"0"}}
+			return response, nil
+		case 2:
+			return httpmock.NewStringResponse(http.StatusTooManyRequests, ""), nil
+		}
+		response := httpmock.NewBytesResponse(http.StatusOK, images)
+		response.Header = http.Header{"Content-Type": []string{"application/json"}}
+		response.Request = request
+		return response, nil
+	})
+
+	err = testutil.CollectAndCompare(exporter, strings.NewReader(glanceExpectedUp), "openstack_glance_images", "openstack_glance_up", "openstack_scrape_collector_success")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 3, attempts)
+
+	// Every attempt is recorded with its own status code.
+	for _, code := range []string{"503", "429", "200"} {
+		assert.Equal(suite.T(), 1.0, testutil.ToFloat64(metrics.requests.WithLabelValues("image", "GET", "v2/images", code)), code)
+	}
+
+	// The retries are exhausted.
+	attempts = 0
+	httpmock.RegisterResponder("GET", url, func(request *http.Request) (*http.Response, error) {
+		attempts++
+		return httpmock.NewStringResponse(http.StatusServiceUnavailable, ""), nil
+	})
+	err = testutil.CollectAndCompare(exporter, strings.NewReader(glanceExpectedDown), "openstack_glance_up", "openstack_scrape_collector_success")
+	assert.NoError(suite.T(), err)
+	assert.Equal(suite.T(), 3, attempts)
+}
+
+func TestRetryable(t *testing.T) {
+	get, _ := http.NewRequest("GET", "http://nova", nil)
+	post, _ := http.NewRequest("POST", "http://nova", strings.NewReader("{}"))
+	for _, test := range []struct {
+		request  *http.Request
+		code     int
+		expected bool
+	}{
+		{get, http.StatusServiceUnavailable, true},
+		{get, http.StatusTooManyRequests, true},
+		{get, http.StatusInternalServerError, false},
+		{get, http.StatusNotFound, false},
+		{post, http.StatusServiceUnavailable, false},
+	} {
+		response := &http.Response{StatusCode: test.code}
+		assert.Equal(t, test.expected, retryable(test.request, response, nil), "%s %d", test.request.Method, test.code)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for value, expected := range map[string]time.Duration{
+		"3": 3 * time.Second,
+		time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat): 0,
+	} {
+		delay, ok := retryAfter(&http.Response{Header: http.Header{"Retry-After": []string{value}}})
+		assert.True(t, ok, value)
+		assert.Equal(t, expected, delay, value)
+	}
+
+	_, ok := retryAfter(&http.Response{Header: http.Header{"Retry-After": []string{"soon"}}})
+	assert.False(t, ok)
+}
+
+func TestRateLimits(t *testing.T) {
+	assert.Nil(t, NewRateLimits(0, 10))
+
+	limits := NewRateLimits(10, 2)
+	assert.Zero(t, limits.reserve("http://nova"))
+	assert.Zero(t, limits.reserve("http://nova"))
+	// The burst is spent, the next request waits for a token.
+	delay := limits.reserve("http://nova")
+	assert.True(t, delay > 50*time.Millisecond && delay <= 100*time.Millisecond, delay.String())
+	// The endpoints have their own bucket.
+	assert.Zero(t, limits.reserve("http://glance"))
+}
@@ -0,0 +1,144 @@
+package exporters
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// SeriesLimits cap the number of series sent by a collection of an exporter,
+// protecting Prometheus from the metrics having one series per resource on
+// large clouds. Zero doesn't cap anything.
+type SeriesLimits struct {
+	// PerMetric is the maximum number of series of each metric.
+	PerMetric int
+	// PerService is the maximum number of series of all the metrics of the
+	// exporter, which are cut in the order of the metric names.
+	PerService int
+}
+
+// seriesBudget counts the series sent by a collection against the limits, and
+// the ones dropped over them. With a limit per service, the series are held
+// back until the end of the collection, so that the same ones are cut whatever
+// the order the ListFuncs run in.
+type seriesBudget struct {
+	limits SeriesLimits
+
+	sync.Mutex
+	series  map[string]int
+	held    map[string][]prometheus.Metric
+	dropped map[string]int
+}
+
+// newSeriesBudget returns the budget of a collection, or nil when limits don't
+// cap anything.
+func newSeriesBudget(limits SeriesLimits) *seriesBudget {
+	if limits.PerMetric <= 0 && limits.PerService <= 0 {
+		return nil
+	}
+	return &seriesBudget{
+		limits:  limits,
+		series:  make(map[string]int),
+		held:    make(map[string][]prometheus.Metric),
+		dropped: make(map[string]int),
+	}
+}
+
+// send sends series of metric to ch when it is within the limit of metric, or
+// holds it back for flush when the service has a limit too.
+func (budget *seriesBudget) send(ch chan<- prometheus.Metric, metric string, series prometheus.Metric) {
+	if budget == nil {
+		ch <- series
+		return
+	}
+
+	budget.Lock()
+	if budget.limits.PerMetric > 0 && budget.series[metric] >= budget.limits.PerMetric {
+		budget.dropped[metric]++
+		budget.Unlock()
+		return
+	}
+	budget.series[metric]++
+	if budget.limits.PerService > 0 {
+		budget.held[metric] = append(budget.held[metric], series)
+		budget.Unlock()
+		return
+	}
+	budget.Unlock()
+	ch <- series
+}
+
+// flush sends the series held back by the collection within the limit of the
+// service, the metrics being taken in the order of their names.
+func (budget *seriesBudget) flush(ch chan<- prometheus.Metric) {
+	if budget == nil {
+		return
+	}
+
+	budget.Lock()
+	defer budget.Unlock()
+
+	metrics := make([]string, 0, len(budget.held))
+	for metric := range budget.held {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+
+	total := 0
+	for _, metric := range metrics {
+		for _, series := range budget.held[metric] {
+			if total >= budget.limits.PerService {
+				budget.dropped[metric]++
+				continue
+			}
+			ch <- series
+			total++
+		}
+	}
+	budget.held = make(map[string][]prometheus.Metric)
+}
+
+// droppedSeries keeps the number of series of each metric dropped by all the
+// collections of an exporter.
+type droppedSeries struct {
+	desc *prometheus.Desc
+
+	sync.Mutex
+	totals map[string]float64
+}
+
+func newDroppedSeries(desc *prometheus.Desc) *droppedSeries {
+	return &droppedSeries{desc: desc, totals: make(map[string]float64)}
+}
+
+// record adds the series dropped by the collection of budget, warning about
+// each metric cut short.
+func (dropped *droppedSeries) record(budget *seriesBudget, logger log.Logger, exporter string) {
+	if budget == nil {
+		return
+	}
+
+	dropped.Lock()
+	defer dropped.Unlock()
+	for metric, count := range budget.dropped {
+		logger.Warnf("Dropped %d series of metric: %s for exporter: %s over the series limits", count, metric, exporter)
+		dropped.totals[metric] += float64(count)
+	}
+}
+
+// collect sends the counters of the metrics which had series dropped.
+func (dropped *droppedSeries) collect(ch chan<- prometheus.Metric) {
+	dropped.Lock()
+	defer dropped.Unlock()
+
+	metrics := make([]string, 0, len(dropped.totals))
+	for metric := range dropped.totals {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+	for _, metric := range metrics {
+		ch <- prometheus.MustNewConstMetric(dropped.desc, prometheus.CounterValue, dropped.totals[metric], metric)
+	}
+}
@@ -0,0 +1,112 @@
+package exporters
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// snapshot keeps the metrics gathered by the last complete background refresh
+// of an exporter, so that scrapes don't have to wait for the OpenStack APIs.
+type snapshot struct {
+	sync.RWMutex
+	metrics   []prometheus.Metric
+	timestamp time.Time
+	duration  time.Duration
+	// stop cancels the refresh in progress and ends the polling.
+	stop context.CancelFunc
+}
+
+// StartPolling refreshes the exporter metrics every RefreshInterval in a
+// background goroutine. Once polling is started, Collect replays the last
+// complete snapshot instead of calling the ListFuncs.
+func (exporter *BaseOpenStackExporter) StartPolling() {
+	if exporter.snapshot != nil || exporter.RefreshInterval <= 0 {
+		return
+	}
+
+	exporter.addMetric("snapshot_age_seconds", nil, nil, nil)
+	exporter.addMetric("refresh_duration_seconds", nil, nil, nil)
+	ctx, stop := context.WithCancel(context.Background())
+	exporter.snapshot = &snapshot{stop: stop}
+
+	exporter.logger().Infof("Refreshing metrics for exporter: %s every %s", exporter.GetName(), exporter.RefreshInterval)
+	go exporter.poll(ctx)
+}
+
+func (exporter *BaseOpenStackExporter) poll(ctx context.Context) {
+	ticker := time.NewTicker(exporter.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		exporter.refresh(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			exporter.logger().Infof("Stopped refreshing metrics for exporter: %s", exporter.GetName())
+			return
+		}
+	}
+}
+
+// Stop stops the background polling of the exporter, if any. The scrapes are
+// still served from the last snapshot, so that a stopped exporter can keep
+// answering the scrapes in flight.
+func (exporter *BaseOpenStackExporter) Stop() {
+	if exporter.snapshot != nil {
+		exporter.snapshot.stop()
+	}
+}
+
+func (exporter *BaseOpenStackExporter) refresh(ctx context.Context) {
+	start := time.Now()
+
+	ch := make(chan prometheus.Metric)
+	done := make(chan []prometheus.Metric)
+	go func() {
+		var metrics []prometheus.Metric
+		for metric := range ch {
+			metrics = append(metrics, metric)
+		}
+		done <- metrics
+	}()
+
+	exporter.collectMetrics(ctx, ch)
+	close(ch)
+	metrics := <-done
+
+	// Keep the previous snapshot rather than one cut short by Stop.
+	if ctx.Err() != nil {
+		return
+	}
+
+	exporter.snapshot.Lock()
+	defer exporter.snapshot.Unlock()
+	exporter.snapshot.metrics = metrics
+	exporter.snapshot.timestamp = time.Now()
+	exporter.snapshot.duration = time.Since(start)
+	exporter.logger().Debugf("Refreshed %d metrics for exporter: %s in %s", len(metrics), exporter.GetName(), exporter.snapshot.duration)
+}
+
+func (s *snapshot) replay(exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if s.timestamp.IsZero() {
+		exporter.logger().Debugf("No snapshot available yet for exporter: %s", exporter.GetName())
+		return
+	}
+
+	for _, metric := range s.metrics {
+		ch <- metric
+	}
+
+	if metric, ok := exporter.Metrics["snapshot_age_seconds"]; ok {
+		ch <- prometheus.MustNewConstMetric(metric.Metric, prometheus.GaugeValue, time.Since(s.timestamp).Seconds())
+	}
+	if metric, ok := exporter.Metrics["refresh_duration_seconds"]; ok {
+		ch <- prometheus.MustNewConstMetric(metric.Metric, prometheus.GaugeValue, s.duration.Seconds())
+	}
+}
@@ -0,0 +1,81 @@
+package exporters
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type SnapshotTestSuite struct {
+	BaseOpenStackTestSuite
+}
+
+func (suite *SnapshotTestSuite) TestSnapshotIsReplayed() {
+	exporter, err := NewExporter(suite.ServiceName, cloudName, "public", ExporterConfig{
+		Prefix:          suite.Prefix,
+		RefreshInterval: time.Hour,
+	})
+	assert.NoError(suite.T(), err)
+
+	glance := exporter.(*GlanceExporter)
+	assert.True(suite.T(), eventually(func() bool {
+		glance.snapshot.RLock()
+		defer glance.snapshot.RUnlock()
+		return !glance.snapshot.timestamp.IsZero()
+	}))
+
+	// Scrapes must be answered from the snapshot even when the API goes away.
+	suite.teardownFixtures()
+	defer suite.installFixtures()
+
+	err = testutil.CollectAndCompare(exporter, strings.NewReader(glanceExpectedUp), "openstack_glance_images", "openstack_glance_up", "openstack_scrape_collector_success")
+	assert.NoError(suite.T(), err)
+
+	for _, name := range []string{"snapshot_age_seconds", "refresh_duration_seconds"} {
+		_, ok := glance.Metrics[name]
+		assert.True(suite.T(), ok, name)
+	}
+}
+
+func (suite *SnapshotTestSuite) TestStopEndsPolling() {
+	exporter, err := NewExporter(suite.ServiceName, cloudName, "public", ExporterConfig{
+		Prefix:          suite.Prefix,
+		RefreshInterval: 10 * time.Millisecond,
+	})
+	assert.NoError(suite.T(), err)
+
+	glance := exporter.(*GlanceExporter)
+	timestamp := func() time.Time {
+		glance.snapshot.RLock()
+		defer glance.snapshot.RUnlock()
+		return glance.snapshot.timestamp
+	}
+	assert.True(suite.T(), eventually(func() bool { return !timestamp().IsZero() }))
+
+	exporter.Stop()
+	// A refresh may have been running while stopping. Reading the call counts
+	// orders its requests, left behind by Stop, before the mock is reset.
+	time.Sleep(20 * time.Millisecond)
+	httpmock.GetCallCountInfo()
+	stopped := timestamp()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(suite.T(), stopped, timestamp())
+
+	// The last snapshot is still served.
+	err = testutil.CollectAndCompare(exporter, strings.NewReader(glanceExpectedUp), "openstack_glance_images", "openstack_glance_up", "openstack_scrape_collector_success")
+	assert.NoError(suite.T(), err)
+}
+
+// eventually polls condition until it holds or a second elapsed, as the
+// assert.Eventually of this testify version races with itself.
+func eventually(condition func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if condition() {
+			return true
+		}
+	}
+	return condition()
+}
@@ -0,0 +1,115 @@
+package exporters
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+)
+
+// Status describes the health of an exporter as of its last collection.
+type Status struct {
+	Service string `json:"service"`
+	Region  string `json:"region,omitempty"`
+	// Endpoint is the catalog endpoint of the service, empty when it couldn't
+	// be resolved.
+	Endpoint string `json:"endpoint"`
+	// Microversion is the API microversion in use, empty meaning the base one.
+	Microversion string `json:"microversion,omitempty"`
+	// TokenValid is false when the exporter has no token or when its last
+	// collection failed to authenticate.
+	TokenValid bool `json:"token_valid"`
+	// LastCollection is the end of the last collection, nil before the first.
+	LastCollection *time.Time `json:"last_collection,omitempty"`
+	LastSuccess    bool       `json:"last_success"`
+	// Healthy tells whether the token is valid, the endpoint resolved and the
+	// last collection, if any, succeeded.
+	Healthy bool `json:"healthy"`
+	// Collectors are the results of the last run of each ListFunc.
+	Collectors map[string]CollectorStatus `json:"collectors,omitempty"`
+	// Metrics are the labels of the metrics of the exporter, by name.
+	Metrics map[string][]string `json:"metrics,omitempty"`
+	// DisabledMetrics are the names of the metrics left out by the filters.
+	DisabledMetrics []string `json:"disabled_metrics,omitempty"`
+}
+
+// CollectorStatus is the result of the last run of a ListFunc.
+type CollectorStatus struct {
+	Timestamp time.Time `json:"timestamp"`
+	Duration  float64   `json:"duration_seconds"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// collectionStatus keeps the results of the last collection of an exporter.
+// It is shared by the copies of the exporter scoped to each collection.
+type collectionStatus struct {
+	sync.RWMutex
+	timestamp  time.Time
+	success    bool
+	authFailed bool
+	collectors map[string]CollectorStatus
+}
+
+func newCollectionStatus() *collectionStatus {
+	return &collectionStatus{collectors: make(map[string]CollectorStatus)}
+}
+
+// record saves the results of a collection, collectors being the results of
+// the ListFuncs it ran.
+func (status *collectionStatus) record(collectors map[string]CollectorStatus, authFailed bool) {
+	status.Lock()
+	defer status.Unlock()
+
+	status.timestamp = time.Now()
+	status.success = true
+	status.authFailed = authFailed
+	for name, collector := range collectors {
+		status.collectors[name] = collector
+		if collector.Error != "" {
+			status.success = false
+		}
+	}
+}
+
+// Status returns the health of the exporter.
+func (exporter *BaseOpenStackExporter) Status() Status {
+	status := Status{Service: exporter.Name, Region: exporter.Region, Microversion: exporter.Microversion, DisabledMetrics: exporter.disabled}
+	status.Metrics = make(map[string][]string, len(exporter.Metrics))
+	for name, metric := range exporter.Metrics {
+		if !metric.disabled {
+			status.Metrics[name] = append([]string{}, metric.Labels...)
+		}
+	}
+	if exporter.Client != nil {
+		status.Endpoint = exporter.Client.Endpoint
+		status.TokenValid = exporter.Client.ProviderClient != nil && exporter.Client.Token() != ""
+	}
+
+	if exporter.status != nil {
+		exporter.status.RLock()
+		defer exporter.status.RUnlock()
+		if !exporter.status.timestamp.IsZero() {
+			timestamp := exporter.status.timestamp
+			status.LastCollection = &timestamp
+			status.LastSuccess = exporter.status.success
+			status.TokenValid = status.TokenValid && !exporter.status.authFailed
+		}
+		status.Collectors = make(map[string]CollectorStatus, len(exporter.status.collectors))
+		for name, collector := range exporter.status.collectors {
+			status.Collectors[name] = collector
+		}
+	}
+
+	status.Healthy = status.TokenValid && status.Endpoint != "" && (status.LastCollection == nil || status.LastSuccess)
+	return status
+}
+
+// isAuthError tells whether err comes from a request that couldn't be
+// authenticated, even after renewing the token.
+func isAuthError(err error) bool {
+	switch err.(type) {
+	case gophercloud.ErrDefault401, *gophercloud.ErrUnableToReauthenticate, *gophercloud.ErrErrorAfterReauthentication:
+		return true
+	}
+	return false
+}
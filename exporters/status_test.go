@@ -0,0 +1,49 @@
+package exporters
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatus(t *testing.T) {
+	client := &gophercloud.ServiceClient{
+		ProviderClient: &gophercloud.ProviderClient{TokenID: "token"},
+		Endpoint:       "http://nova:8774/v2.1/",
+	}
+	exporter := BaseOpenStackExporter{
+		Name:           "nova",
+		ExporterConfig: ExporterConfig{Prefix: "openstack", Client: client, Region: "RegionOne"},
+	}
+	var listErr error
+	exporter.AddMetric("servers", func(ctx context.Context, exporter *BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+		return listErr
+	}, nil, nil)
+
+	// The exporter is healthy before its first collection.
+	status := exporter.Status()
+	assert.Equal(t, "http://nova:8774/v2.1/", status.Endpoint)
+	assert.True(t, status.TokenValid)
+	assert.Nil(t, status.LastCollection)
+	assert.True(t, status.Healthy)
+
+	listErr = gophercloud.ErrDefault401{}
+	exporter.Collect(make(chan prometheus.Metric, 10))
+	status = exporter.Status()
+	assert.NotNil(t, status.LastCollection)
+	assert.False(t, status.LastSuccess)
+	assert.False(t, status.TokenValid)
+	assert.False(t, status.Healthy)
+	assert.NotEmpty(t, status.Collectors["servers"].Error)
+
+	listErr = nil
+	exporter.Collect(make(chan prometheus.Metric, 10))
+	status = exporter.Status()
+	assert.True(t, status.LastSuccess)
+	assert.True(t, status.TokenValid)
+	assert.True(t, status.Healthy)
+	assert.Empty(t, status.Collectors["servers"].Error)
+}
@@ -0,0 +1,94 @@
+package exporters
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloudTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// A self-signed certificate serves as both the CA bundle and the client
+	// certificate.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "exporter"},
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	verify := false
+	transport, err := cloudTransport(&clientconfig.Cloud{}, log.Base())
+	assert.NoError(t, err)
+	assert.Nil(t, transport)
+
+	transport, err = cloudTransport(&clientconfig.Cloud{Verify: &verify}, log.Base())
+	assert.NoError(t, err)
+	assert.True(t, transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify)
+
+	transport, err = cloudTransport(&clientconfig.Cloud{CACertFile: certFile, ClientCertFile: certFile, ClientKeyFile: keyFile}, log.Base())
+	assert.NoError(t, err)
+	tlsConfig := transport.(*http.Transport).TLSClientConfig
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.Len(t, tlsConfig.Certificates, 1)
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+
+	for _, cloud := range []*clientconfig.Cloud{
+		{CACertFile: filepath.Join(dir, "missing.pem")},
+		{CACertFile: keyFile},
+		{ClientCertFile: certFile},
+		{ClientCertFile: certFile, ClientKeyFile: certFile},
+	} {
+		_, err := cloudTransport(cloud, log.Base())
+		assert.Error(t, err, fmt.Sprintf("%+v", cloud))
+	}
+}
+
+func TestCertificateExpiryIsRecorded(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	metrics := NewAPIMetrics("openstack")
+	client := &http.Client{Transport: metrics.Transport(server.Client().Transport)}
+	response, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	response.Body.Close()
+
+	host := strings.TrimPrefix(server.URL, "https://")
+	err = testutil.CollectAndCompare(metrics, strings.NewReader(fmt.Sprintf(`
+# HELP openstack_api_certificate_expiry_timestamp_seconds Earliest expiry time of the certificates presented by the OpenStack API endpoint, in seconds since the epoch
+# TYPE openstack_api_certificate_expiry_timestamp_seconds gauge
+openstack_api_certificate_expiry_timestamp_seconds{host="%s",service_type="unknown"} %d
+`, host, server.Certificate().NotAfter.Unix())), "openstack_api_certificate_expiry_timestamp_seconds")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,209 @@
+package exporters
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// APIMetrics are the metrics of the requests sent to the OpenStack APIs by the
+// transports it instruments.
+type APIMetrics struct {
+	requests     *prometheus.CounterVec
+	duration     *prometheus.HistogramVec
+	responseSize *prometheus.HistogramVec
+	certExpiry   *prometheus.GaugeVec
+}
+
+// NewAPIMetrics returns the API metrics named with prefix, to be registered
+// once and shared by all the exporters.
+func NewAPIMetrics(prefix string) *APIMetrics {
+	labels := []string{"service_type", "method", "path"}
+	return &APIMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(prefix, "api", "requests_total"),
+			Help: "Number of requests sent to the OpenStack API, by status code",
+		}, append(labels, "code")),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    prometheus.BuildFQName(prefix, "api", "request_duration_seconds"),
+			Help:    "Duration of the requests sent to the OpenStack API until their response headers",
+			Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+		}, labels),
+		responseSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    prometheus.BuildFQName(prefix, "api", "response_size_bytes"),
+			Help:    "Size of the response bodies read from the OpenStack API",
+			Buckets: prometheus.ExponentialBuckets(256, 4, 9),
+		}, labels),
+		certExpiry: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(prefix, "api", "certificate_expiry_timestamp_seconds"),
+			Help: "Earliest expiry time of the certificates presented by the OpenStack API endpoint, in seconds since the epoch",
+		}, []string{"service_type", "host"}),
+	}
+}
+
+func (metrics *APIMetrics) Describe(ch chan<- *prometheus.Desc) {
+	metrics.requests.Describe(ch)
+	metrics.duration.Describe(ch)
+	metrics.responseSize.Describe(ch)
+	metrics.certExpiry.Describe(ch)
+}
+
+func (metrics *APIMetrics) Collect(ch chan<- prometheus.Metric) {
+	metrics.requests.Collect(ch)
+	metrics.duration.Collect(ch)
+	metrics.responseSize.Collect(ch)
+	metrics.certExpiry.Collect(ch)
+}
+
+// Transport returns a transport sending the requests through next, nil meaning
+// http.DefaultTransport, and recording them in metrics.
+func (metrics *APIMetrics) Transport(next http.RoundTripper) http.RoundTripper {
+	return &instrumentedTransport{next: next, metrics: metrics, endpoints: make(map[string]string)}
+}
+
+// instrumentedTransport labels the requests with the service type of the
+// longest known endpoint their URL starts with, and with their path relative
+// to that endpoint.
+type instrumentedTransport struct {
+	next    http.RoundTripper
+	metrics *APIMetrics
+
+	sync.RWMutex
+	endpoints map[string]string
+}
+
+func (transport *instrumentedTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	serviceType, path := transport.resolve(request.URL.Scheme + "://" + request.URL.Host + request.URL.Path)
+	labels := prometheus.Labels{"service_type": serviceType, "method": request.Method, "path": path}
+
+	next := transport.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	start := time.Now()
+	response, err := next.RoundTrip(request)
+	transport.metrics.duration.With(labels).Observe(time.Since(start).Seconds())
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(response.StatusCode)
+		response.Body = &countingBody{ReadCloser: response.Body, observer: transport.metrics.responseSize.With(labels)}
+		if expiry, ok := earliestExpiry(response); ok {
+			transport.metrics.certExpiry.WithLabelValues(serviceType, request.URL.Host).Set(float64(expiry.Unix()))
+		}
+	}
+	labels["code"] = code
+	transport.metrics.requests.With(labels).Inc()
+
+	return response, err
+}
+
+func (transport *instrumentedTransport) track(endpoint, serviceType string) {
+	transport.Lock()
+	defer transport.Unlock()
+	transport.endpoints[endpoint] = serviceType
+}
+
+func (transport *instrumentedTransport) resolve(url string) (string, string) {
+	transport.RLock()
+	defer transport.RUnlock()
+
+	serviceType, base := "unknown", ""
+	for endpoint, endpointType := range transport.endpoints {
+		if strings.HasPrefix(url, endpoint) && len(endpoint) > len(base) {
+			serviceType, base = endpointType, endpoint
+		}
+	}
+
+	path := strings.TrimPrefix(url, base)
+	if base == "" {
+		// Keep the path only, the scheme and host vary with the clouds.
+		if index := strings.Index(url, "://"); index >= 0 {
+			path = url[index+3:]
+		}
+		if index := strings.Index(path, "/"); index >= 0 {
+			path = path[index:]
+		}
+	}
+	return serviceType, normalisePath(path)
+}
+
+// trackEndpoint makes the instrumented transport of client, if any, label the
+// requests sent to the client endpoint with serviceType.
+func trackEndpoint(client *gophercloud.ServiceClient, serviceType string) {
+	if transport, ok := instrumented(client.ProviderClient.HTTPClient.Transport); ok {
+		transport.track(client.Endpoint, serviceType)
+	}
+}
+
+// instrumented returns the instrumented transport of the chain of transports
+// starting at transport, which may be wrapped by the retries.
+func instrumented(transport http.RoundTripper) (*instrumentedTransport, bool) {
+	for {
+		switch next := transport.(type) {
+		case *instrumentedTransport:
+			return next, true
+		case *retryTransport:
+			transport = next.next
+		default:
+			return nil, false
+		}
+	}
+}
+
+// earliestExpiry returns the earliest expiry time of the certificates the
+// server of response presented, if it was served over TLS.
+func earliestExpiry(response *http.Response) (time.Time, bool) {
+	if response.TLS == nil || len(response.TLS.PeerCertificates) == 0 {
+		return time.Time{}, false
+	}
+	earliest := response.TLS.PeerCertificates[0].NotAfter
+	for _, cert := range response.TLS.PeerCertificates[1:] {
+		if cert.NotAfter.Before(earliest) {
+			earliest = cert.NotAfter
+		}
+	}
+	return earliest, true
+}
+
+var idPattern = regexp.MustCompile(`^([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{32}|[0-9]+)$`)
+
+// normalisePath replaces the identifiers found in path by ":id", so that the
+// requests to different resources of a collection share the same labels.
+func normalisePath(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		if idPattern.MatchString(segment) {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// countingBody observes the number of bytes read from a response body once it
+// is closed.
+type countingBody struct {
+	io.ReadCloser
+	observer prometheus.Observer
+	size     int
+	once     sync.Once
+}
+
+func (body *countingBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	body.size += n
+	return n, err
+}
+
+func (body *countingBody) Close() error {
+	body.once.Do(func() { body.observer.Observe(float64(body.size)) })
+	return body.ReadCloser.Close()
+}
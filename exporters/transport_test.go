@@ -0,0 +1,44 @@
+package exporters
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type TransportTestSuite struct {
+	BaseOpenStackTestSuite
+}
+
+func (suite *TransportTestSuite) TestRequestsAreRecorded() {
+	apiMetrics := NewAPIMetrics(suite.Prefix)
+	exporter, err := NewExporter(suite.ServiceName, cloudName, "public", ExporterConfig{
+		Prefix:     suite.Prefix,
+		APIMetrics: apiMetrics,
+	})
+	assert.NoError(suite.T(), err)
+
+	err = testutil.CollectAndCompare(exporter, strings.NewReader(glanceExpectedUp), "openstack_glance_images", "openstack_glance_up", "openstack_scrape_collector_success")
+	assert.NoError(suite.T(), err)
+
+	err = testutil.CollectAndCompare(apiMetrics, strings.NewReader(`
+# HELP openstack_api_requests_total Number of requests sent to the OpenStack API, by status code
+# TYPE openstack_api_requests_total counter
+openstack_api_requests_total{code="200",method="GET",path="v2/images",service_type="image"} 1
+openstack_api_requests_total{code="201",method="POST",path="v3/auth/tokens",service_type="identity"} 1
+`), "openstack_api_requests_total")
+	assert.NoError(suite.T(), err)
+}
+
+func TestNormalisePath(t *testing.T) {
+	for path, expected := range map[string]string{
+		"/v2/images/": "v2/images",
+		"servers/2ce4c5b3-2866-4972-93ce-77a2ea46a7f9/diagnostics": "servers/:id/diagnostics",
+		"v2.1/0c4e939acacf4376bdcd1129f1a054ad/servers":            "v2.1/:id/servers",
+		"os-hypervisors/42": "os-hypervisors/:id",
+	} {
+		assert.Equal(t, expected, normalisePath(path), path)
+	}
+}
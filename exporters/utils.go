@@ -1,16 +1,20 @@
 package exporters
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/gophercloud/openstack"
 	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/prometheus/common/log"
 )
 
-func AuthenticatedClient(opts *clientconfig.ClientOpts, transport *http.Transport) (*gophercloud.ProviderClient, error) {
+func AuthenticatedClient(opts *clientconfig.ClientOpts, transport http.RoundTripper) (*gophercloud.ProviderClient, error) {
 	options, err := clientconfig.AuthOptions(opts)
 	if err != nil {
 		return nil, err
@@ -27,6 +31,9 @@ func AuthenticatedClient(opts *clientconfig.ClientOpts, transport *http.Transpor
 	if transport != nil {
 		client.HTTPClient.Transport = transport
 	}
+	if instrumented, ok := instrumented(transport); ok {
+		instrumented.track(client.IdentityBase, "identity")
+	}
 
 	err = openstack.Authenticate(client, *options)
 	if err != nil {
@@ -35,15 +42,67 @@ func AuthenticatedClient(opts *clientconfig.ClientOpts, transport *http.Transpor
 	return client, nil
 }
 
-// NewServiceClient is a convenience function to get a new service client.
-func NewServiceClient(service string, opts *clientconfig.ClientOpts, transport *http.Transport, endpointType string) (*gophercloud.ServiceClient, error) {
-	cloud := new(clientconfig.Cloud)
+// cloudTransport returns the transport to use for the cloud entry, nil meaning
+// the default one. The CA bundle and the client certificate of the entry, if
+// any, are used for all the endpoints of the cloud.
+func cloudTransport(cloud *clientconfig.Cloud, logger log.Logger) (http.RoundTripper, error) {
+	insecure := cloud.Verify != nil && !*cloud.Verify
+	if !insecure && cloud.CACertFile == "" && cloud.ClientCertFile == "" && cloud.ClientKeyFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+	if insecure {
+		logger.Infoln("SSL verification disabled on transport")
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	if cloud.CACertFile != "" {
+		content, err := ioutil.ReadFile(cloud.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading cacert failed: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("no certificate found in cacert %s", cloud.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
 
+	if cloud.ClientCertFile != "" || cloud.ClientKeyFile != "" {
+		if cloud.ClientCertFile == "" || cloud.ClientKeyFile == "" {
+			return nil, fmt.Errorf("cert and key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(cloud.ClientCertFile, cloud.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading the client certificate failed: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// NewServiceClient is a convenience function to get a new service client.
+//
+// Deprecated: the cloud and its region are looked up in the environment
+// (OS_CLOUD, OS_REGION_NAME) and clouds.yaml, use New with explicit Options.
+func NewServiceClient(service string, opts *clientconfig.ClientOpts, transport http.RoundTripper, endpointType string) (*gophercloud.ServiceClient, error) {
 	// If no opts were passed in, create an empty ClientOpts.
 	if opts == nil {
 		opts = new(clientconfig.ClientOpts)
 	}
 
+	// Get a Provider Client
+	pClient, err := AuthenticatedClient(opts, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	cloud := new(clientconfig.Cloud)
+
 	// Determine if a clouds.yaml entry should be retrieved.
 	// Start by figuring out the cloud name.
 	// First check if one was explicitly specified in opts.
@@ -65,17 +124,15 @@ func NewServiceClient(service string, opts *clientconfig.ClientOpts, transport *
 	// If a cloud name was determined, try to look it up in clouds.yaml.
 	if cloudName != "" {
 		// Get the requested cloud.
-		var err error
 		cloud, err = clientconfig.GetCloudFromYAML(opts)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	// Get a Provider Client
-	pClient, err := AuthenticatedClient(opts, transport)
+	registered, err := DefaultRegistry.Service(service)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("unable to create a service client for %s", service)
 	}
 
 	// Determine the region to use.
@@ -101,70 +158,36 @@ func NewServiceClient(service string, opts *clientconfig.ClientOpts, transport *
 		Availability: GetEndpointType(endpointType),
 	}
 
-	// Keep a map of the EndpointOpts for each service
-	if endpointOpts == nil {
-		endpointOpts = make(map[string]gophercloud.EndpointOpts)
-	}
-	endpointOpts[service] = eo
-
-	switch service {
-	case "clustering":
-		return openstack.NewClusteringV1(pClient, eo)
-	case "compute":
-		return openstack.NewComputeV2(pClient, eo)
-	case "container":
-		return openstack.NewContainerV1(pClient, eo)
-	case "container-infra":
-		return openstack.NewContainerInfraV1(pClient, eo)
-	case "database":
-		return openstack.NewDBV1(pClient, eo)
-	case "dns":
-		return openstack.NewDNSV2(pClient, eo)
-	case "identity":
-		identityVersion := "3"
-		if v := cloud.IdentityAPIVersion; v != "" {
-			identityVersion = v
-		}
-
-		switch identityVersion {
-		case "v2", "2", "2.0":
-			return openstack.NewIdentityV2(pClient, eo)
-		case "v3", "3":
-			return openstack.NewIdentityV3(pClient, eo)
-		default:
-			return nil, fmt.Errorf("invalid identity API version")
-		}
-	case "image":
-		return openstack.NewImageServiceV2(pClient, eo)
-	case "load-balancer":
-		return openstack.NewLoadBalancerV2(pClient, eo)
-	case "network":
-		return openstack.NewNetworkV2(pClient, eo)
-	case "object-store":
-		return openstack.NewObjectStorageV1(pClient, eo)
-	case "orchestration":
-		return openstack.NewOrchestrationV1(pClient, eo)
-	case "sharev2":
-		return openstack.NewSharedFileSystemV2(pClient, eo)
-	case "volume":
-		volumeVersion := "2"
-		if v := cloud.VolumeAPIVersion; v != "" {
-			volumeVersion = v
-		}
+	return serviceClient(registered, cloud, pClient, eo, "")
+}
 
-		switch volumeVersion {
-		case "v1", "1":
-			return openstack.NewBlockStorageV1(pClient, eo)
-		case "v2", "2":
-			return openstack.NewBlockStorageV2(pClient, eo)
-		case "v3", "3":
-			return openstack.NewBlockStorageV3(pClient, eo)
-		default:
-			return nil, fmt.Errorf("invalid volume API version")
-		}
+// serviceClient returns the client of service using the authenticated provider
+// client pClient, at the endpoint found by eo in the service catalog or at url
+// when given.
+func serviceClient(service Service, cloud *clientconfig.Cloud, pClient *gophercloud.ProviderClient, eo gophercloud.EndpointOpts, url string) (*gophercloud.ServiceClient, error) {
+	if url != "" {
+		return endpointClient(service, cloud, pClient, eo, url)
 	}
+	return service.newClient(pClient, eo, cloud)
+}
 
-	return nil, fmt.Errorf("unable to create a service client for %s", service)
+// endpointClient returns the client of service using the endpoint at url
+// rather than the one found by eo in the service catalog.
+func endpointClient(service Service, cloud *clientconfig.Cloud, pClient *gophercloud.ProviderClient, eo gophercloud.EndpointOpts, url string) (*gophercloud.ServiceClient, error) {
+	// The client is built for a provider client locating every endpoint at
+	// url, so that it gets the same resource base as from the catalog.
+	locator := &gophercloud.ProviderClient{
+		IdentityBase: pClient.IdentityBase,
+		EndpointLocator: func(gophercloud.EndpointOpts) (string, error) {
+			return gophercloud.NormalizeURL(url), nil
+		},
+	}
+	client, err := service.newClient(locator, eo, cloud)
+	if err != nil {
+		return nil, err
+	}
+	client.ProviderClient = pClient
+	return client, nil
 }
 
 func GetEndpointType(endpointType string) gophercloud.Availability {
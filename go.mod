@@ -8,8 +8,10 @@ require (
 	github.com/jarcoal/httpmock v1.0.4
 	github.com/kr/pretty v0.2.0 // indirect
 	github.com/prometheus/client_golang v1.2.1
-	github.com/prometheus/client_model v0.0.0-20191202183732-d1d2010b5bee // indirect
+	github.com/prometheus/client_model v0.0.0-20191202183732-d1d2010b5bee
 	github.com/prometheus/common v0.7.0
 	github.com/stretchr/testify v1.4.0
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
+	gopkg.in/yaml.v2 v2.2.7
 )
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/openstack-exporter/openstack-exporter/exporters"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/log"
+)
+
+// scrapeContext returns the context of a scrape request, bounded by the timeout
+// announced by Prometheus minus offset, so that the exporter answers with what
+// it has before Prometheus gives up on the scrape.
+func scrapeContext(r *http.Request, offset time.Duration) (context.Context, context.CancelFunc) {
+	header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if header == "" {
+		return context.WithCancel(r.Context())
+	}
+
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil {
+		log.Warnf("Ignoring invalid X-Prometheus-Scrape-Timeout-Seconds header: %s", header)
+		return context.WithCancel(r.Context())
+	}
+
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > offset {
+		timeout -= offset
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// metricsHandler serves the metrics of the exporters along with the ones of the
+// default registry, collecting the exporters within the scrape context.
+func metricsHandler(manager *exporterManager, offset time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := scrapeContext(r, offset)
+		defer cancel()
+		ctx = exporters.WithCache(ctx)
+
+		registry := prometheus.NewRegistry()
+		for _, exporter := range manager.exporters() {
+			if err := registry.Register(exporters.WithContext(ctx, exporter)); err != nil {
+				log.Errorf("registering exporter for service %s failed: %s", exporter.GetName(), err)
+			}
+		}
+
+		gatherers := prometheus.Gatherers{prometheus.DefaultGatherer, registry}
+		promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}
+}
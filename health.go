@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/openstack-exporter/openstack-exporter/exporters"
+	"github.com/prometheus/common/log"
+)
+
+// readiness is the body of the readiness endpoint.
+type readiness struct {
+	Ready    bool               `json:"ready"`
+	Services []exporters.Status `json:"services"`
+}
+
+// healthzHandler tells that the exporter is alive, whatever the state of the
+// OpenStack APIs.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := w.Write([]byte("OK\n")); err != nil {
+		log.Error(err)
+	}
+}
+
+// readyHandler reports the status of the enabled exporters, and fails with 503
+// when none of them is healthy. The exporter is ready when no service is
+// configured, as it only serves probes then.
+func readyHandler(manager *exporterManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		enabled := manager.exporters()
+		body := readiness{Ready: len(enabled) == 0 && len(manager.failures()) == 0, Services: []exporters.Status{}}
+		for _, exporter := range enabled {
+			status := exporter.Status()
+			body.Ready = body.Ready || status.Healthy
+			body.Services = append(body.Services, status)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !body.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(body); err != nil {
+			log.Error(err)
+		}
+	}
+}
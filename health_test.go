@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/openstack-exporter/openstack-exporter/exporters"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestManager returns a manager with the exporters enabled.
+func newTestManager(enabled ...exporters.OpenStackExporter) *exporterManager {
+	manager := newExporterManager("openstack", time.Second, time.Second)
+	var specs []exporterSpec
+	for index := range enabled {
+		specs = append(specs, exporterSpec{service: strconv.Itoa(index)})
+	}
+	manager.update(specs, func(service, region string) (exporters.OpenStackExporter, error) {
+		index, _ := strconv.Atoi(service)
+		return enabled[index], nil
+	})
+	return manager
+}
+
+func TestReadyHandler(t *testing.T) {
+	healthy := &exporters.BaseOpenStackExporter{Name: "nova", ExporterConfig: exporters.ExporterConfig{
+		Client: &gophercloud.ServiceClient{
+			ProviderClient: &gophercloud.ProviderClient{TokenID: "token"},
+			Endpoint:       "http://nova:8774/v2.1/",
+		},
+	}}
+	// No endpoint could be resolved for this one.
+	unhealthy := &exporters.BaseOpenStackExporter{Name: "glance"}
+
+	for _, test := range []struct {
+		enabled []exporters.OpenStackExporter
+		code    int
+	}{
+		{nil, http.StatusOK},
+		{[]exporters.OpenStackExporter{unhealthy}, http.StatusServiceUnavailable},
+		{[]exporters.OpenStackExporter{unhealthy, healthy}, http.StatusOK},
+	} {
+		recorder := httptest.NewRecorder()
+		readyHandler(newTestManager(test.enabled...))(recorder, httptest.NewRequest("GET", "/ready", nil))
+		assert.Equal(t, test.code, recorder.Code)
+
+		var body readiness
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		assert.Equal(t, test.code == http.StatusOK, body.Ready)
+		assert.Len(t, body.Services, len(test.enabled))
+	}
+}
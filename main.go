@@ -3,32 +3,56 @@ package main
 import (
 	"fmt"
 	"github.com/openstack-exporter/openstack-exporter/exporters"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/log"
 	"github.com/prometheus/common/version"
 	"gopkg.in/alecthomas/kingpin.v2"
 	"net/http"
 	"os"
+	"time"
 )
 
-var defaultEnabledServices = []string{"network", "compute", "image", "volume", "identity", "object-store", "load-balancer", "container-infra"}
 var DEFAULT_OS_CLIENT_CONFIG = "/etc/openstack/clouds.yaml"
 
 func main() {
 	var (
-		logLevel        = kingpin.Flag("log.level", "Log level: [debug, info, warn, error, fatal]").Default("info").String()
-		bind            = kingpin.Flag("web.listen-address", "address:port to listen on").Default(":9180").String()
-		metrics         = kingpin.Flag("web.telemetry-path", "uri path to expose metrics").Default("/metrics").String()
-		osClientConfig  = kingpin.Flag("os-client-config", "Path to the cloud configuration file").Default(DEFAULT_OS_CLIENT_CONFIG).String()
-		prefix          = kingpin.Flag("prefix", "Prefix for metrics").Default("openstack").String()
-		endpointType    = kingpin.Flag("endpoint-type", "openstack endpoint type to use (i.e: public, internal, admin)").Default("public").String()
-		disabledMetrics = kingpin.Flag("disable-metric", "multiple --disable-metric can be specified in the format: service-metric (i.e: cinder-snapshots)").Default("").Short('d').Strings()
-		cloud           = kingpin.Arg("cloud", "name or id of the cloud to gather metrics from").Required().String()
+		logLevel          = kingpin.Flag("log.level", "Log level: [debug, info, warn, error, fatal]").Default("info").String()
+		bind              = kingpin.Flag("web.listen-address", "address:port to listen on").Default(":9180").String()
+		metrics           = kingpin.Flag("web.telemetry-path", "uri path to expose metrics").Default("/metrics").String()
+		osClientConfig    = kingpin.Flag("os-client-config", "Path to the cloud configuration file").Default(DEFAULT_OS_CLIENT_CONFIG).String()
+		prefix            = kingpin.Flag("prefix", "Prefix for metrics").Default("openstack").String()
+		endpointType      = kingpin.Flag("endpoint-type", "openstack endpoint type to use (i.e: public, internal, admin)").Default("public").String()
+		endpointTypes     = kingpin.Flag("service.endpoint-type", "multiple --service.endpoint-type can be specified in the format: service=type (i.e: object-store=public) to use another endpoint type than --endpoint-type for a service").PlaceHolder("SERVICE=TYPE").StringMap()
+		endpoints         = kingpin.Flag("service.endpoint", "multiple --service.endpoint can be specified in the format: service=url (i.e: load-balancer=https://octavia.example.com:9876) to use an endpoint instead of the one of the service catalog").PlaceHolder("SERVICE=URL").StringMap()
+		disabledMetrics   = kingpin.Flag("disable-metric", "multiple --disable-metric can be specified in the format: service-metric (i.e: cinder-snapshots), as a glob (i.e: nova-server_diagnostics_*) or a regular expression between slashes").Default("").Short('d').Strings()
+		enabledMetrics    = kingpin.Flag("enable-metric", "multiple --enable-metric can be specified in the same format as --disable-metric, only the metrics matched are collected").Short('e').Strings()
+		refreshInterval   = kingpin.Flag("refresh-interval", "collect metrics in the background at this interval and serve scrapes from the last snapshot (i.e: 5m), 0 collects on every scrape").Default("0s").Duration()
+		concurrency       = kingpin.Flag("collector.concurrency", "maximum number of API listings run at the same time by each service exporter, 0 doesn't limit them").Default("4").Int()
+		globalConcurrency = kingpin.Flag("collector.global-concurrency", "maximum number of API listings run at the same time across all the service exporters, 0 doesn't limit them").Default("0").Int()
+		timeout           = kingpin.Flag("collector.timeout", "maximum duration of a collection of each service exporter, 0 doesn't limit it").Default("0s").Duration()
+		seriesPerMetric   = kingpin.Flag("collector.max-series-per-metric", "maximum number of series of each metric sent by a collection, the ones over it are dropped and counted, 0 doesn't limit them").Default("0").Int()
+		seriesPerService  = kingpin.Flag("collector.max-series-per-service", "maximum number of series of all the metrics sent by a collection of each service exporter, the ones over it are dropped in the order of the metric names and counted, 0 doesn't limit them").Default("0").Int()
+		serviceTimeouts   = kingpin.Flag("collector.service-timeout", "multiple --collector.service-timeout can be specified in the format: service=duration (i.e: compute=30s), overrides --collector.timeout").PlaceHolder("SERVICE=DURATION").StringMap()
+		timeoutOffset     = kingpin.Flag("web.timeout-offset", "time subtracted from the scrape timeout announced by Prometheus, to leave time to answer").Default("500ms").Duration()
+		probePath         = kingpin.Flag("web.probe-path", "uri path to probe any cloud from the configuration file (i.e: /probe?cloud=mycloud&service=compute)").Default("/probe").String()
+		regions           = kingpin.Flag("region", "multiple --region can be specified to collect metrics from several regions of the cloud, \"all\" collects all the regions of the service catalog (defaults to the region of the cloud entry)").Strings()
+		discoverServices  = kingpin.Flag("discover-services", "enable only the exporters of the services found in the service catalog of the cloud, in the region and for the endpoint type of each exporter").Bool()
+		configFile        = kingpin.Flag("config.file", "Path to the exporter configuration file, the flags given on the command line override its settings").Default("").String()
+		retryInterval     = kingpin.Flag("startup.retry-interval", "delay before retrying to enable a service exporter which failed at startup, doubled after each failure").Default("5s").Duration()
+		maxRetryInterval  = kingpin.Flag("startup.max-retry-interval", "maximum delay between the retries of a service exporter which failed at startup").Default("5m").Duration()
+		maxRetries        = kingpin.Flag("api.max-retries", "number of retries of the API GET requests which fail, are throttled (429) or meet an unavailable API (502, 503, 504), 0 disables them").Default("2").Int()
+		retryBackoff      = kingpin.Flag("api.retry-backoff", "delay before the first retry of an API request, doubled after each retry and randomized by up to half").Default("500ms").Duration()
+		maxRetryBackoff   = kingpin.Flag("api.max-retry-backoff", "maximum delay between two attempts of an API request, including the one asked by a Retry-After header").Default("10s").Duration()
+		microversions     = kingpin.Flag("api.microversion", "multiple --api.microversion can be specified in the format: service=microversion (i.e: compute=2.60) to pin the microversion of the compute, volume and load-balancer services, or latest to negotiate it, the base microversion is used otherwise").PlaceHolder("SERVICE=MICROVERSION").StringMap()
+		rateLimit         = kingpin.Flag("api.rate-limit", "maximum number of requests per second sent to each API endpoint, 0 doesn't limit them").Default("0").Float64()
+		rateBurst         = kingpin.Flag("api.rate-burst", "number of requests which can be sent at once to an API endpoint above --api.rate-limit").Default("10").Int()
+		webConfigFile     = kingpin.Flag("web.config.file", "Path to the web configuration file enabling TLS and basic authentication, in the format of the Prometheus exporter-toolkit").Default("").String()
+		cloud             = kingpin.Arg("cloud", "name or id of the cloud to gather metrics from, if omitted only the probe endpoint is served").String()
 	)
 
 	services := make(map[string]*bool)
 
-	for _, service := range defaultEnabledServices {
+	for _, service := range exporters.DefaultRegistry.Types() {
 		flagName := fmt.Sprintf("disable-service.%s", service)
 		flagHelp := fmt.Sprintf("Disable the %s service exporter", service)
 		services[service] = kingpin.Flag(flagName, flagHelp).Default().Bool()
@@ -47,44 +71,214 @@ func main() {
 	log.Infof("Starting openstack exporter version %s for cloud: %s", version.Info(), *cloud)
 	log.Infoln("Build context", version.BuildContext())
 
+	// clouds.yaml is looked up in the standard locations unless given.
+	clouds := exporters.CloudsYAML{}
 	if *osClientConfig != DEFAULT_OS_CLIENT_CONFIG {
-		log.Debugf("Setting Env var OS_CLIENT_CONFIG_FILE = %s", *osClientConfig)
-		os.Setenv("OS_CLIENT_CONFIG_FILE", *osClientConfig)
+		log.Debugf("Reading the clouds from %s", *osClientConfig)
+		clouds.Path = *osClientConfig
 	}
 
-	enabledExporters := 0
-	for service, disabled := range services {
-		if !*disabled {
-			_, err := exporters.EnableExporter(service, *prefix, *cloud, *disabledMetrics, *endpointType)
+	var webConfig *webConfig
+	if *webConfigFile != "" {
+		webConfig, err = loadWebConfig(*webConfigFile)
+		if err != nil {
+			log.Errorf("Cannot load web configuration: %s", err)
+			os.Exit(-1)
+		}
+	}
+
+	// load reads the configuration file, if any, overridden by the flags. It is
+	// called again on every reload.
+	given := givenFlags(os.Args[1:])
+	load := func() (*Config, error) {
+		config := &Config{}
+		if *configFile != "" {
+			loaded, err := loadConfig(*configFile)
 			if err != nil {
-				// Log error and continue with enabling other exporters
-				log.Errorf("enabling exporter for service %s failed: %s", service, err)
-				continue
+				return nil, fmt.Errorf("cannot load configuration: %s", err)
 			}
-			log.Infof("Enabled exporter for service: %s", service)
-			enabledExporters++
+			config = loaded
+		}
+
+		// The flags given on the command line take precedence over the
+		// configuration file, which itself takes precedence over the flag
+		// defaults.
+		if given["prefix"] || config.Prefix == "" {
+			config.Prefix = *prefix
+		}
+		if given["endpoint-type"] || config.EndpointType == "" {
+			config.overrideEndpointType(*endpointType, given["endpoint-type"])
+		}
+		if given["refresh-interval"] {
+			config.overrideRefreshInterval(*refreshInterval)
+		}
+		if given["collector.timeout"] {
+			config.overrideTimeout(*timeout)
+		}
+		if given["collector.max-series-per-metric"] {
+			config.overrideMaxSeriesPerMetric(*seriesPerMetric)
+		}
+		if given["collector.max-series-per-service"] {
+			config.overrideMaxSeriesPerService(*seriesPerService)
+		}
+		if given["region"] {
+			config.overrideRegions(*regions)
+		}
+		if given["discover-services"] {
+			config.overrideDiscoverServices(*discoverServices)
+		}
+		if given["enable-metric"] {
+			config.overrideEnabledMetrics(*enabledMetrics)
+		}
+		config.DisabledMetrics = append(config.DisabledMetrics, *disabledMetrics...)
+		if err := config.validate(); err != nil {
+			return nil, fmt.Errorf("invalid settings: %s", err)
 		}
+		for service, disabled := range services {
+			if *disabled {
+				config.disableService(service)
+			}
+		}
+		for service, value := range *serviceTimeouts {
+			if !isKnownService(service) {
+				return nil, fmt.Errorf("unknown service in --collector.service-timeout: %s", service)
+			}
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timeout for service %s: %s", service, err)
+			}
+			config.overrideServiceTimeout(service, duration)
+		}
+		for service, endpointType := range *endpointTypes {
+			if !isKnownService(service) {
+				return nil, fmt.Errorf("unknown service in --service.endpoint-type: %s", service)
+			}
+			if err := validateEndpointType(endpointType); err != nil {
+				return nil, fmt.Errorf("invalid --service.endpoint-type: %s", err)
+			}
+			config.overrideServiceEndpointType(service, endpointType)
+		}
+		for service, endpoint := range *endpoints {
+			if !isKnownService(service) {
+				return nil, fmt.Errorf("unknown service in --service.endpoint: %s", service)
+			}
+			if err := validateEndpoint(endpoint); err != nil {
+				return nil, fmt.Errorf("invalid --service.endpoint: %s", err)
+			}
+			config.overrideServiceEndpoint(service, endpoint)
+		}
+		for service, microversion := range *microversions {
+			if !isKnownService(service) {
+				return nil, fmt.Errorf("unknown service in --api.microversion: %s", service)
+			}
+			if err := exporters.ValidateMicroversion(service, microversion); err != nil {
+				return nil, fmt.Errorf("invalid --api.microversion: %s", err)
+			}
+			config.overrideMicroversion(service, microversion)
+		}
+		if *cloud != "" {
+			config.Cloud = *cloud
+		}
+		config.clouds = clouds
+		return config, nil
 	}
 
-	if enabledExporters == 0 {
-		log.Errorln("No exporter has been enabled, exiting")
+	config, err := load()
+	if err != nil {
+		log.Errorln(err)
 		os.Exit(-1)
 	}
 
-	http.Handle(*metrics, promhttp.Handler())
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		_, err := w.Write([]byte(`<html>
-             <head><title>OpenStack Exporter</title></head>
-             <body>
-             <h1>OpenStack Exporter</h1>
-             <p><a href='` + *metrics + `'>Metrics</a></p>
-             </body>
-             </html>`))
+	apiMetrics := exporters.NewAPIMetrics(config.Prefix)
+	prometheus.MustRegister(apiMetrics)
+
+	providers := exporters.NewProviders(config.Prefix)
+	prometheus.MustRegister(providers)
+
+	base := exporters.ExporterConfig{
+		Concurrency:   *concurrency,
+		GlobalLimiter: exporters.NewLimiter(*globalConcurrency),
+		APIMetrics:    apiMetrics,
+		Providers:     providers,
+		Retry: exporters.RetryPolicy{
+			MaxRetries: *maxRetries,
+			Backoff:    *retryBackoff,
+			MaxBackoff: *maxRetryBackoff,
+		},
+		RateLimits: exporters.NewRateLimits(*rateLimit, *rateBurst),
+	}
+
+	manager := newExporterManager(config.Prefix, *retryInterval, *maxRetryInterval)
+	prometheus.MustRegister(manager)
+
+	if config.Cloud != "" {
+		specs, err := exporterSpecs(config, base)
 		if err != nil {
-			log.Error(err)
+			log.Errorf("Cannot enable the exporters of cloud %s: %s", config.Cloud, err)
+			os.Exit(-1)
+		}
+
+		// The services which fail to be enabled are retried in the background,
+		// unless they can't succeed.
+		manager.update(specs, newExporterBuilder(config, base))
+		if !manager.active() {
+			log.Errorln("No exporter can be enabled, exiting")
+			os.Exit(-1)
 		}
-	})
+	} else {
+		log.Infof("No cloud given, only serving probes on %s", *probePath)
+	}
+
+	pool := newExporterPool(config, base)
+	reloader := &reloader{load: load, prefix: config.Prefix, base: base, manager: manager, pool: pool}
+	reloader.watchSignals()
+
+	http.Handle(*metrics, metricsHandler(manager, *timeoutOffset))
+	http.Handle(*probePath, probeHandler(pool, *timeoutOffset))
+	http.HandleFunc("/-/reload", reloader.handler)
+	http.HandleFunc("/healthz", healthzHandler)
+	http.Handle("/ready", readyHandler(manager))
+	page := statusPage{Cloud: config.Cloud, MetricsPath: *metrics}
+	http.Handle("/status", statusHandler(page, manager, true))
+	http.Handle("/", statusHandler(page, manager, false))
 
 	log.Infoln("Starting HTTP server on", *bind)
-	log.Fatal(http.ListenAndServe(*bind, nil))
+	log.Fatal(listenAndServe(*bind, http.DefaultServeMux, webConfig))
+}
+
+// givenFlags returns the names of the flags given in args.
+func givenFlags(args []string) map[string]bool {
+	given := make(map[string]bool)
+	context, err := kingpin.CommandLine.ParseContext(args)
+	if err != nil {
+		return given
+	}
+	for _, element := range context.Elements {
+		if flag, ok := element.Clause.(*kingpin.FlagClause); ok {
+			given[flag.Model().Name] = true
+		}
+	}
+	return given
+}
+
+// resolveRegions expands the regions requested for cloud: none means the region
+// of the cloud entry, and "all" every region of the service catalog.
+func resolveRegions(config *Config, cloud string, regions []string, base exporters.ExporterConfig) ([]string, error) {
+	if len(regions) == 0 {
+		return []string{""}, nil
+	}
+	for _, region := range regions {
+		if region == "all" {
+			entry, err := config.cloudEntry(cloud)
+			if err != nil {
+				return nil, err
+			}
+			catalog, err := exporters.ServiceCatalog(exporters.Options{ExporterConfig: base, Cloud: cloud, CloudConfig: entry})
+			if err != nil {
+				return nil, err
+			}
+			return catalog.Regions(), nil
+		}
+	}
+	return regions, nil
 }
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/openstack-exporter/openstack-exporter/exporters"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+const (
+	statePending = "pending"
+	stateEnabled = "enabled"
+	stateFailed  = "failed"
+)
+
+var serviceStates = []string{statePending, stateEnabled, stateFailed}
+
+// exporterSpec identifies the exporter of a service in a region.
+type exporterSpec struct {
+	service string
+	region  string
+	// settings is a fingerprint of the settings the exporter is built with,
+	// the exporter is rebuilt on reload when they change.
+	settings string
+}
+
+// managedService is the exporter of a service in a region, which is pending
+// until it could be built.
+type managedService struct {
+	exporterSpec
+	build    exporterBuilder
+	state    string
+	exporter exporters.OpenStackExporter
+	err      error
+	// removed is closed once the service is no longer managed, which ends its
+	// retries.
+	removed chan struct{}
+}
+
+// exporterBuilder builds the exporter of service in region.
+type exporterBuilder func(service, region string) (exporters.OpenStackExporter, error)
+
+// exporterManager keeps the service exporters served on the metrics path. The
+// services whose exporter fails to build are retried in the background, with an
+// exponential backoff, until they succeed or fail permanently.
+type exporterManager struct {
+	sync.RWMutex
+	// updates serializes the calls to update.
+	updates     sync.Mutex
+	interval    time.Duration
+	maxInterval time.Duration
+	services    []*managedService
+	stateDesc   *prometheus.Desc
+}
+
+func newExporterManager(prefix string, interval, maxInterval time.Duration) *exporterManager {
+	return &exporterManager{
+		interval:    interval,
+		maxInterval: maxInterval,
+		stateDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(prefix, "exporter", "service_state"),
+			"State of the exporter of a service: pending while it is retried, enabled or permanently failed",
+			[]string{"service", "region", "state"}, nil),
+	}
+}
+
+// update makes the manager serve the exporters of specs, built with build. The
+// enabled exporters whose spec didn't change are kept, the other ones are
+// built before being swapped in, so that the scrapes are served by the previous
+// exporters meanwhile. The exporters which fail to build with an error which
+// may be temporary are retried in the background.
+func (manager *exporterManager) update(specs []exporterSpec, build exporterBuilder) {
+	manager.updates.Lock()
+	defer manager.updates.Unlock()
+
+	manager.RLock()
+	current := make(map[exporterSpec]*managedService)
+	for _, managed := range manager.services {
+		if managed.state == stateEnabled {
+			current[managed.exporterSpec] = managed
+		}
+	}
+	manager.RUnlock()
+
+	var services, added []*managedService
+	kept := make(map[*managedService]bool)
+	for _, spec := range specs {
+		if managed, ok := current[spec]; ok {
+			services = append(services, managed)
+			kept[managed] = true
+			continue
+		}
+		managed := &managedService{exporterSpec: spec, build: build, state: statePending, removed: make(chan struct{})}
+		services = append(services, managed)
+		added = append(added, managed)
+	}
+
+	for _, managed := range added {
+		manager.try(managed)
+	}
+
+	manager.Lock()
+	previous := manager.services
+	manager.services = services
+	manager.Unlock()
+
+	for _, managed := range previous {
+		if !kept[managed] {
+			manager.remove(managed)
+		}
+	}
+	for _, managed := range added {
+		if manager.state(managed) == statePending {
+			go manager.retry(managed)
+		}
+	}
+}
+
+// try builds the exporter of managed and records the outcome, telling whether
+// it succeeded.
+func (manager *exporterManager) try(managed *managedService) bool {
+	exporter, err := managed.build(managed.service, managed.region)
+
+	manager.Lock()
+	defer manager.Unlock()
+	select {
+	case <-managed.removed:
+		// The service was dropped by a reload while building its exporter.
+		if exporter != nil {
+			exporter.Stop()
+		}
+		return false
+	default:
+	}
+
+	if err != nil {
+		managed.err = err
+		if isPermanentError(err) {
+			managed.state = stateFailed
+			log.Errorf("enabling exporter for service %s in region %s failed permanently: %s", managed.service, managed.region, err)
+		} else {
+			log.Errorf("enabling exporter for service %s in region %s failed, retrying: %s", managed.service, managed.region, err)
+		}
+		return false
+	}
+
+	managed.state = stateEnabled
+	managed.exporter = exporter
+	managed.err = nil
+	log.Infof("Enabled exporter for service: %s in region: %s", managed.service, managed.region)
+	return true
+}
+
+func (manager *exporterManager) retry(managed *managedService) {
+	interval := manager.interval
+	for {
+		select {
+		case <-time.After(interval):
+		case <-managed.removed:
+			return
+		}
+		if manager.try(managed) || manager.state(managed) != statePending {
+			return
+		}
+		interval *= 2
+		if interval > manager.maxInterval {
+			interval = manager.maxInterval
+		}
+	}
+}
+
+// remove ends the retries and the polling of a service which is no longer
+// managed.
+func (manager *exporterManager) remove(managed *managedService) {
+	manager.Lock()
+	close(managed.removed)
+	exporter := managed.exporter
+	manager.Unlock()
+
+	if exporter != nil {
+		exporter.Stop()
+	}
+}
+
+func (manager *exporterManager) state(managed *managedService) string {
+	manager.RLock()
+	defer manager.RUnlock()
+	return managed.state
+}
+
+// exporters returns the enabled exporters.
+func (manager *exporterManager) exporters() []exporters.OpenStackExporter {
+	manager.RLock()
+	defer manager.RUnlock()
+
+	var enabled []exporters.OpenStackExporter
+	for _, managed := range manager.services {
+		if managed.state == stateEnabled {
+			enabled = append(enabled, managed.exporter)
+		}
+	}
+	return enabled
+}
+
+// failures returns the services which are not enabled, with the error of
+// their last attempt.
+func (manager *exporterManager) failures() []startupFailure {
+	manager.RLock()
+	defer manager.RUnlock()
+
+	failures := []startupFailure{}
+	for _, managed := range manager.services {
+		if managed.state != stateEnabled {
+			failure := startupFailure{Service: managed.service, Region: managed.region, State: managed.state}
+			if managed.err != nil {
+				failure.Error = managed.err.Error()
+			}
+			failures = append(failures, failure)
+		}
+	}
+	return failures
+}
+
+// active tells whether any exporter is enabled or still retried.
+func (manager *exporterManager) active() bool {
+	manager.RLock()
+	defer manager.RUnlock()
+
+	for _, managed := range manager.services {
+		if managed.state != stateFailed {
+			return true
+		}
+	}
+	return false
+}
+
+func (manager *exporterManager) Describe(ch chan<- *prometheus.Desc) {
+	ch <- manager.stateDesc
+}
+
+func (manager *exporterManager) Collect(ch chan<- prometheus.Metric) {
+	manager.RLock()
+	defer manager.RUnlock()
+
+	for _, managed := range manager.services {
+		for _, state := range serviceStates {
+			value := 0.0
+			if managed.state == state {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(manager.stateDesc, prometheus.GaugeValue, value, managed.service, managed.region, state)
+		}
+	}
+}
+
+// isPermanentError tells whether retrying to build an exporter which failed
+// with err is pointless, i.e. because the service is missing from the catalog.
+func isPermanentError(err error) bool {
+	switch err.(type) {
+	case *gophercloud.ErrEndpointNotFound, gophercloud.ErrEndpointNotFound:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/openstack-exporter/openstack-exporter/exporters"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExporterManagerRetries(t *testing.T) {
+	var mutex sync.Mutex
+	attempts := make(map[string]int)
+	exporter := &exporters.BaseOpenStackExporter{Name: "nova"}
+
+	manager := newExporterManager("openstack", 50*time.Millisecond, 100*time.Millisecond)
+	manager.update([]exporterSpec{
+		{service: "compute", region: "RegionOne"},
+		{service: "image", region: "RegionOne"},
+	}, func(service, region string) (exporters.OpenStackExporter, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		attempts[service]++
+		switch {
+		case service == "image":
+			return nil, &gophercloud.ErrEndpointNotFound{}
+		case service == "compute" && attempts[service] < 3:
+			return nil, errors.New("keystone is unavailable")
+		}
+		return exporter, nil
+	})
+	assert.True(t, manager.active())
+
+	err := testutil.CollectAndCompare(manager, strings.NewReader(`
+# HELP openstack_exporter_service_state State of the exporter of a service: pending while it is retried, enabled or permanently failed
+# TYPE openstack_exporter_service_state gauge
+openstack_exporter_service_state{region="RegionOne",service="compute",state="enabled"} 0
+openstack_exporter_service_state{region="RegionOne",service="compute",state="failed"} 0
+openstack_exporter_service_state{region="RegionOne",service="compute",state="pending"} 1
+openstack_exporter_service_state{region="RegionOne",service="image",state="enabled"} 0
+openstack_exporter_service_state{region="RegionOne",service="image",state="failed"} 1
+openstack_exporter_service_state{region="RegionOne",service="image",state="pending"} 0
+`))
+	assert.NoError(t, err)
+
+	assert.True(t, eventually(func() bool { return len(manager.exporters()) == 1 }))
+	assert.Equal(t, []startupFailure{
+		{Service: "image", Region: "RegionOne", State: stateFailed, Error: "No suitable endpoint could be found in the service catalog."},
+	}, manager.failures())
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, 3, attempts["compute"])
+	assert.Equal(t, 1, attempts["image"])
+}
+
+// stoppableExporter records whether it was stopped.
+type stoppableExporter struct {
+	exporters.BaseOpenStackExporter
+	stopped bool
+}
+
+func (exporter *stoppableExporter) Stop() {
+	exporter.stopped = true
+}
+
+func TestExporterManagerUpdate(t *testing.T) {
+	built := make(map[string]*stoppableExporter)
+	build := func(settings string) exporterBuilder {
+		return func(service, region string) (exporters.OpenStackExporter, error) {
+			exporter := &stoppableExporter{BaseOpenStackExporter: exporters.BaseOpenStackExporter{Name: service}}
+			built[service+"/"+settings] = exporter
+			return exporter, nil
+		}
+	}
+
+	manager := newExporterManager("openstack", time.Second, time.Second)
+	manager.update([]exporterSpec{
+		{service: "compute", settings: "a"},
+		{service: "image", settings: "a"},
+		{service: "volume", settings: "a"},
+	}, build("a"))
+	assert.Len(t, manager.exporters(), 3)
+
+	// The unchanged exporters are kept, the changed ones rebuilt and the
+	// dropped ones stopped.
+	manager.update([]exporterSpec{
+		{service: "compute", settings: "a"},
+		{service: "image", settings: "b"},
+	}, build("b"))
+
+	enabled := manager.exporters()
+	if assert.Len(t, enabled, 2) {
+		assert.Equal(t, built["compute/a"], enabled[0])
+		assert.Equal(t, built["image/b"], enabled[1])
+	}
+	assert.False(t, built["compute/a"].stopped)
+	assert.True(t, built["image/a"].stopped)
+	assert.True(t, built["volume/a"].stopped)
+	assert.NotContains(t, built, "compute/b")
+}
+
+// eventually polls condition until it holds or a second elapsed, as the
+// assert.Eventually of this testify version races with itself.
+func eventually(condition func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if condition() {
+			return true
+		}
+	}
+	return condition()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/openstack-exporter/openstack-exporter/exporters"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/log"
+)
+
+// exporterPool keeps the exporters built by the probe handler, so repeated probes
+// of the same cloud reuse their authenticated clients instead of logging in again.
+type exporterPool struct {
+	sync.Mutex
+	config    *Config
+	base      exporters.ExporterConfig
+	exporters map[string]exporters.OpenStackExporter
+}
+
+func newExporterPool(config *Config, base exporters.ExporterConfig) *exporterPool {
+	return &exporterPool{
+		config:    config,
+		base:      base,
+		exporters: make(map[string]exporters.OpenStackExporter),
+	}
+}
+
+// settings returns the configuration the exporters of the pool are built with.
+func (pool *exporterPool) settings() *Config {
+	pool.Lock()
+	defer pool.Unlock()
+	return pool.config
+}
+
+// reset makes the pool build its exporters with config, dropping the ones built
+// with the previous configuration.
+func (pool *exporterPool) reset(config *Config) {
+	pool.Lock()
+	previous := pool.exporters
+	pool.config = config
+	pool.exporters = make(map[string]exporters.OpenStackExporter)
+	pool.Unlock()
+
+	for _, exporter := range previous {
+		exporter.Stop()
+	}
+}
+
+func (pool *exporterPool) get(cloud, region, service string) (exporters.OpenStackExporter, error) {
+	key := fmt.Sprintf("%s/%s/%s", cloud, region, service)
+
+	pool.Lock()
+	exporter, ok := pool.exporters[key]
+	config := pool.config
+	pool.Unlock()
+	if ok {
+		return exporter, nil
+	}
+
+	// Build the exporter without holding the lock, authenticating against a slow
+	// cloud must not block the probes of the other ones.
+	options, err := config.exporterOptions(cloud, service, region, pool.base)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err = exporters.New(options)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Enabled exporter for service: %s on cloud: %s region: %s", service, cloud, region)
+
+	pool.Lock()
+	defer pool.Unlock()
+	if pool.config != config {
+		// The pool was reset meanwhile, only serve this probe with the exporter.
+		exporter.Stop()
+		return exporter, nil
+	}
+	if existing, ok := pool.exporters[key]; ok {
+		exporter.Stop()
+		return existing, nil
+	}
+	pool.exporters[key] = exporter
+	return exporter, nil
+}
+
+// probeHandler serves the metrics of the cloud given in the cloud query parameter,
+// restricted to the services given in the service parameters (all the enabled
+// services of the cloud by default) and to the regions given in the region
+// parameters (the regions of the cloud by default), from a registry dedicated
+// to the request.
+func probeHandler(pool *exporterPool, offset time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config := pool.settings()
+		ctx, cancel := scrapeContext(r, offset)
+		defer cancel()
+		ctx = exporters.WithCache(ctx)
+
+		params := r.URL.Query()
+
+		cloud := params.Get("cloud")
+		if cloud == "" {
+			http.Error(w, "cloud parameter is missing", http.StatusBadRequest)
+			return
+		}
+
+		// The services given explicitly are probed even when discovering them.
+		requested := params["service"]
+		var catalog *exporters.Catalog
+		if len(requested) == 0 {
+			requested = config.enabledServices(cloud)
+			var err error
+			if catalog, err = serviceCatalog(config, cloud, pool.base); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		regions := params["region"]
+		if len(regions) == 0 {
+			regions = config.regions(cloud)
+		}
+		regions, err := resolveRegions(config, cloud, regions, pool.base)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("resolving regions of cloud %s failed: %s", cloud, err), http.StatusInternalServerError)
+			return
+		}
+
+		registry := prometheus.NewRegistry()
+		enabled := 0
+		for _, region := range regions {
+			for _, service := range requested {
+				if endpointType, exporterConfig := config.exporterConfig(cloud, service, pool.base); catalog != nil && exporterConfig.Endpoint == "" && !catalog.Has(service, region, endpointType) {
+					continue
+				}
+				exporter, err := pool.get(cloud, region, service)
+				if err != nil {
+					log.Errorf("enabling exporter for service %s on cloud %s region %s failed: %s", service, cloud, region, err)
+					continue
+				}
+				if err := registry.Register(exporters.WithContext(ctx, exporter)); err != nil {
+					log.Errorf("registering exporter for service %s on cloud %s region %s failed: %s", service, cloud, region, err)
+					continue
+				}
+				enabled++
+			}
+		}
+
+		if enabled == 0 {
+			http.Error(w, fmt.Sprintf("no exporter could be enabled for cloud %s", cloud), http.StatusInternalServerError)
+			return
+		}
+
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/openstack-exporter/openstack-exporter/exporters"
+	"github.com/prometheus/common/log"
+)
+
+// exporterSettings is what an exporter is built with, besides the settings
+// shared by all the exporters.
+type exporterSettings struct {
+	Cloud                *clientconfig.Cloud
+	EndpointType         string
+	Endpoint             string
+	IdentityEndpointType string
+	IdentityEndpoint     string
+	Prefix               string
+	DisabledMetrics      []string
+	EnabledMetrics       []string
+	RefreshInterval      time.Duration
+	Timeout              time.Duration
+	Microversion         string
+	MaxSeries            exporters.SeriesLimits
+}
+
+// exporterSpecs returns the exporters to serve for the cloud of config, with a
+// fingerprint of their settings, which include the cloud entry of clouds.yaml
+// and secure.yaml.
+func exporterSpecs(config *Config, base exporters.ExporterConfig) ([]exporterSpec, error) {
+	if config.Cloud == "" {
+		return nil, nil
+	}
+
+	cloud, err := config.cloudEntry(config.Cloud)
+	if err != nil {
+		return nil, err
+	}
+
+	regions, err := resolveRegions(config, config.Cloud, config.regions(config.Cloud), base)
+	if err != nil {
+		return nil, fmt.Errorf("resolving the regions of cloud %s failed: %s", config.Cloud, err)
+	}
+
+	catalog, err := serviceCatalog(config, config.Cloud, base)
+	if err != nil {
+		return nil, err
+	}
+
+	var specs []exporterSpec
+	for _, region := range regions {
+		for _, service := range config.enabledServices(config.Cloud) {
+			endpointType, exporterConfig := config.exporterConfig(config.Cloud, service, base)
+			if catalog != nil && exporterConfig.Endpoint == "" && !catalog.Has(service, region, endpointType) {
+				log.Infof("Not enabling the %s exporter of cloud %s, the service isn't in the catalog of region %q", service, config.Cloud, region)
+				continue
+			}
+			settings, err := json.Marshal(exporterSettings{
+				Cloud:                cloud,
+				EndpointType:         endpointType,
+				Endpoint:             exporterConfig.Endpoint,
+				IdentityEndpointType: exporterConfig.IdentityEndpointType,
+				IdentityEndpoint:     exporterConfig.IdentityEndpoint,
+				Prefix:               exporterConfig.Prefix,
+				DisabledMetrics:      exporterConfig.DisabledMetrics,
+				EnabledMetrics:       exporterConfig.EnabledMetrics,
+				RefreshInterval:      exporterConfig.RefreshInterval,
+				Timeout:              exporterConfig.Timeout,
+				Microversion:         exporterConfig.Microversion,
+				MaxSeries:            exporterConfig.MaxSeries,
+			})
+			if err != nil {
+				return nil, err
+			}
+			specs = append(specs, exporterSpec{service: service, region: region, settings: string(settings)})
+		}
+	}
+	return specs, nil
+}
+
+// serviceCatalog returns the service catalog of cloud when its services are
+// discovered, nil otherwise.
+func serviceCatalog(config *Config, cloud string, base exporters.ExporterConfig) (*exporters.Catalog, error) {
+	if !config.discoverServices(cloud) {
+		return nil, nil
+	}
+	entry, err := config.cloudEntry(cloud)
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := exporters.ServiceCatalog(exporters.Options{ExporterConfig: base, Cloud: cloud, CloudConfig: entry})
+	if err != nil {
+		return nil, fmt.Errorf("reading the service catalog of cloud %s failed: %s", cloud, err)
+	}
+	return catalog, nil
+}
+
+// newExporterBuilder returns a builder of the exporters of the cloud of config.
+func newExporterBuilder(config *Config, base exporters.ExporterConfig) exporterBuilder {
+	return func(service, region string) (exporters.OpenStackExporter, error) {
+		options, err := config.exporterOptions(config.Cloud, service, region, base)
+		if err != nil {
+			return nil, err
+		}
+		return exporters.New(options)
+	}
+}
+
+// reloader applies the configuration returned by load, along with the current
+// content of clouds.yaml, to the exporters of the metrics path and of the
+// probes.
+type reloader struct {
+	sync.Mutex
+	load    func() (*Config, error)
+	prefix  string
+	base    exporters.ExporterConfig
+	manager *exporterManager
+	pool    *exporterPool
+}
+
+func (reloader *reloader) reload() error {
+	reloader.Lock()
+	defer reloader.Unlock()
+
+	config, err := reloader.load()
+	if err != nil {
+		return err
+	}
+	// The metrics shared by the exporters are registered once with the prefix.
+	if config.Prefix != reloader.prefix {
+		return fmt.Errorf("changing the prefix from %s to %s requires a restart", reloader.prefix, config.Prefix)
+	}
+
+	specs, err := exporterSpecs(config, reloader.base)
+	if err != nil {
+		return err
+	}
+	reloader.manager.update(specs, newExporterBuilder(config, reloader.base))
+	reloader.pool.reset(config)
+	log.Infoln("Reloaded the configuration")
+	return nil
+}
+
+// handler reloads the configuration on POST or PUT requests.
+func (reloader *reloader) handler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		http.Error(w, "Only POST or PUT requests allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := reloader.reload(); err != nil {
+		log.Errorf("Reloading the configuration failed: %s", err)
+		http.Error(w, fmt.Sprintf("failed to reload the configuration: %s", err), http.StatusInternalServerError)
+	}
+}
+
+// watchSignals reloads the configuration whenever the process receives SIGHUP.
+func (reloader *reloader) watchSignals() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := reloader.reload(); err != nil {
+				log.Errorf("Reloading the configuration failed: %s", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openstack-exporter/openstack-exporter/exporters"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadHandler(t *testing.T) {
+	prefix := "openstack"
+	reloader := &reloader{
+		load:    func() (*Config, error) { return &Config{Prefix: prefix}, nil },
+		prefix:  "openstack",
+		manager: newExporterManager("openstack", time.Second, time.Second),
+		pool:    newExporterPool(&Config{}, exporters.ExporterConfig{}),
+	}
+
+	for _, test := range []struct {
+		method string
+		prefix string
+		code   int
+	}{
+		{"GET", "openstack", http.StatusMethodNotAllowed},
+		{"POST", "openstack", http.StatusOK},
+		{"POST", "os", http.StatusInternalServerError},
+	} {
+		prefix = test.prefix
+		recorder := httptest.NewRecorder()
+		reloader.handler(recorder, httptest.NewRequest(test.method, "/-/reload", nil))
+		assert.Equal(t, test.code, recorder.Code)
+	}
+	// The probes use the reloaded configuration.
+	assert.Equal(t, "openstack", reloader.pool.settings().Prefix)
+}
+
+func TestReloadEndpoint(t *testing.T) {
+	config := &Config{Cloud: "test.cloud", clouds: exporters.CloudsYAML{Path: "exporters/fixtures/test_config.yaml"}}
+	config.overrideServiceEndpoint("load-balancer", "https://octavia.example.com:9876")
+
+	built := make(map[string]int)
+	build := func(service, region string) (exporters.OpenStackExporter, error) {
+		built[service]++
+		return &exporters.BaseOpenStackExporter{Name: service}, nil
+	}
+
+	manager := newExporterManager("openstack", time.Second, time.Second)
+	specs, err := exporterSpecs(config, exporters.ExporterConfig{})
+	assert.NoError(t, err)
+	manager.update(specs, build)
+
+	// Only the exporter whose endpoint changed is rebuilt.
+	config.overrideServiceEndpoint("load-balancer", "https://octavia.example.com:9877")
+	specs, err = exporterSpecs(config, exporters.ExporterConfig{})
+	assert.NoError(t, err)
+	manager.update(specs, build)
+
+	assert.Equal(t, 2, built["load-balancer"])
+	assert.Equal(t, 1, built["compute"])
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+
+	"github.com/openstack-exporter/openstack-exporter/exporters"
+	"github.com/prometheus/common/log"
+)
+
+// startupFailure is a service exporter which couldn't be enabled at startup,
+// either pending while it is retried or permanently failed.
+type startupFailure struct {
+	Service string `json:"service"`
+	Region  string `json:"region,omitempty"`
+	State   string `json:"state"`
+	Error   string `json:"error"`
+}
+
+// statusPage is the content of the status page.
+type statusPage struct {
+	Cloud       string             `json:"cloud"`
+	MetricsPath string             `json:"metrics_path"`
+	Services    []exporters.Status `json:"services"`
+	Failures    []startupFailure   `json:"failures"`
+}
+
+var statusTemplate = template.Must(template.New("status").Parse(`<html>
+<head><title>OpenStack Exporter</title></head>
+<body>
+<h1>OpenStack Exporter</h1>
+<p><a href="{{.MetricsPath}}">Metrics</a> - <a href="/status">JSON status</a></p>
+{{if .Cloud}}<h2>Cloud {{.Cloud}}</h2>{{end}}
+{{if .Failures}}
+<h2>Services which failed to start</h2>
+<table border="1">
+<tr><th>Service</th><th>Region</th><th>State</th><th>Error</th></tr>
+{{range .Failures}}<tr><td>{{.Service}}</td><td>{{.Region}}</td><td>{{.State}}</td><td>{{.Error}}</td></tr>
+{{end}}</table>
+{{end}}
+{{range .Services}}
+<h2>{{.Service}}{{if .Region}} ({{.Region}}){{end}}{{if .Healthy}} - healthy{{else}} - unhealthy{{end}}</h2>
+<p>Endpoint: {{if .Endpoint}}{{.Endpoint}}{{else}}unresolved{{end}},{{if .Microversion}} microversion: {{.Microversion}},{{end}} token valid: {{.TokenValid}},
+last collection: {{if .LastCollection}}{{.LastCollection.Format "2006-01-02T15:04:05Z07:00"}}{{else}}none{{end}}</p>
+<table border="1">
+<tr><th>Metric</th><th>Labels</th><th>Last collection</th><th>Duration (s)</th><th>Last error</th></tr>
+{{$collectors := .Collectors}}{{range $name, $labels := .Metrics}}{{$collector := index $collectors $name}}<tr><td>{{$name}}</td><td>{{range $i, $label := $labels}}{{if $i}}, {{end}}{{$label}}{{end}}</td><td>{{if not $collector.Timestamp.IsZero}}{{$collector.Timestamp.Format "2006-01-02T15:04:05Z07:00"}}{{end}}</td><td>{{if not $collector.Timestamp.IsZero}}{{printf "%.3f" $collector.Duration}}{{end}}</td><td>{{$collector.Error}}</td></tr>
+{{end}}</table>
+{{if .DisabledMetrics}}<p>Disabled metrics: {{range $i, $name := .DisabledMetrics}}{{if $i}}, {{end}}{{$name}}{{end}}</p>{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// statusHandler serves the status of the enabled exporters and the startup
+// failures, as HTML or, when asJSON is set, as JSON.
+func statusHandler(page statusPage, manager *exporterManager, asJSON bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current := page
+		current.Services = []exporters.Status{}
+		for _, exporter := range manager.exporters() {
+			current.Services = append(current.Services, exporter.Status())
+		}
+		current.Failures = manager.failures()
+
+		var err error
+		if asJSON {
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(current)
+		} else {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			err = statusTemplate.Execute(w, current)
+		}
+		if err != nil {
+			log.Error(err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/openstack-exporter/openstack-exporter/exporters"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusHandler(t *testing.T) {
+	exporter := &exporters.BaseOpenStackExporter{Name: "glance", ExporterConfig: exporters.ExporterConfig{
+		Prefix:          "openstack",
+		DisabledMetrics: []string{"glance-image_bytes"},
+	}}
+	exporter.AddMetric("images", func(ctx context.Context, exporter *exporters.BaseOpenStackExporter, ch chan<- prometheus.Metric) error {
+		return errors.New("glance is down")
+	}, []string{"tenant_id"}, nil)
+	exporter.AddMetric("image_bytes", nil, nil, nil)
+	exporter.Collect(make(chan prometheus.Metric, 10))
+
+	page := statusPage{Cloud: "mycloud", MetricsPath: "/metrics"}
+	manager := newExporterManager("openstack", time.Second, time.Second)
+	manager.update([]exporterSpec{{service: "image"}, {service: "compute", region: "RegionOne"}}, func(service, region string) (exporters.OpenStackExporter, error) {
+		if service == "compute" {
+			return nil, &gophercloud.ErrEndpointNotFound{}
+		}
+		return exporter, nil
+	})
+
+	recorder := httptest.NewRecorder()
+	statusHandler(page, manager, false)(recorder, httptest.NewRequest("GET", "/", nil))
+	for _, expected := range []string{"mycloud", "compute", "failed", "No suitable endpoint", "images", "tenant_id", "glance is down", "Disabled metrics: image_bytes"} {
+		assert.Contains(t, recorder.Body.String(), expected)
+	}
+
+	recorder = httptest.NewRecorder()
+	statusHandler(page, manager, true)(recorder, httptest.NewRequest("GET", "/status", nil))
+	var body statusPage
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	assert.Equal(t, []startupFailure{
+		{Service: "compute", Region: "RegionOne", State: stateFailed, Error: "No suitable endpoint could be found in the service catalog."},
+	}, body.Failures)
+	if assert.Len(t, body.Services, 1) {
+		assert.Equal(t, []string{"tenant_id"}, body.Services[0].Metrics["images"])
+		assert.Equal(t, []string{"image_bytes"}, body.Services[0].DisabledMetrics)
+		assert.Equal(t, "glance is down", body.Services[0].Collectors["images"].Error)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+
+	"github.com/prometheus/common/log"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+)
+
+// webConfig is the content of the web configuration file, in the format of the
+// Prometheus exporter-toolkit.
+type webConfig struct {
+	TLSServerConfig  tlsServerConfig   `yaml:"tls_server_config"`
+	HTTPServerConfig httpServerConfig  `yaml:"http_server_config"`
+	BasicAuthUsers   map[string]string `yaml:"basic_auth_users"`
+}
+
+type tlsServerConfig struct {
+	CertFile                 string   `yaml:"cert_file"`
+	KeyFile                  string   `yaml:"key_file"`
+	ClientAuthType           string   `yaml:"client_auth_type"`
+	ClientCAFile             string   `yaml:"client_ca_file"`
+	MinVersion               string   `yaml:"min_version"`
+	MaxVersion               string   `yaml:"max_version"`
+	CipherSuites             []string `yaml:"cipher_suites"`
+	PreferServerCipherSuites bool     `yaml:"prefer_server_cipher_suites"`
+}
+
+type httpServerConfig struct {
+	HTTP2 *bool `yaml:"http2"`
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
+var tlsVersions = map[string]uint16{
+	"TLS10": tls.VersionTLS10,
+	"TLS11": tls.VersionTLS11,
+	"TLS12": tls.VersionTLS12,
+	"TLS13": tls.VersionTLS13,
+}
+
+// loadWebConfig reads and validates the web configuration file at path. The
+// relative paths of the file are resolved from its directory.
+func loadWebConfig(path string) (*webConfig, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &webConfig{}
+	if err := yaml.UnmarshalStrict(content, config); err != nil {
+		return nil, fmt.Errorf("parsing %s failed: %s", path, err)
+	}
+
+	tlsConfig := &config.TLSServerConfig
+	for _, file := range []*string{&tlsConfig.CertFile, &tlsConfig.KeyFile, &tlsConfig.ClientCAFile} {
+		if *file != "" && !filepath.IsAbs(*file) {
+			*file = filepath.Join(filepath.Dir(path), *file)
+		}
+	}
+
+	// Validate the TLS settings by building them once.
+	if _, err := config.tlsConfig(); err != nil {
+		return nil, fmt.Errorf("invalid web configuration in %s: %s", path, err)
+	}
+	for user, hash := range config.BasicAuthUsers {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("invalid web configuration in %s: password of user %s: %s", path, user, err)
+		}
+	}
+	return config, nil
+}
+
+// tlsConfig returns the TLS configuration of the server, nil when TLS is not
+// enabled. The certificate is read again on every handshake, so that it can be
+// renewed without restarting the exporter.
+func (config *webConfig) tlsConfig() (*tls.Config, error) {
+	c := config.TLSServerConfig
+	if c.CertFile == "" && c.KeyFile == "" {
+		if c.ClientCAFile != "" || c.ClientAuthType != "" {
+			return nil, fmt.Errorf("client authentication requires cert_file and key_file")
+		}
+		return nil, nil
+	}
+	if c.CertFile == "" {
+		return nil, fmt.Errorf("missing cert_file")
+	}
+	if c.KeyFile == "" {
+		return nil, fmt.Errorf("missing key_file")
+	}
+
+	if _, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile); err != nil {
+		return nil, fmt.Errorf("loading the certificate failed: %s", err)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:               tls.VersionTLS12,
+		PreferServerCipherSuites: c.PreferServerCipherSuites,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+			return &cert, nil
+		},
+	}
+
+	if c.MinVersion != "" {
+		version, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown min_version %q", c.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+	if c.MaxVersion != "" {
+		version, ok := tlsVersions[c.MaxVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown max_version %q", c.MaxVersion)
+		}
+		tlsConfig.MaxVersion = version
+	}
+
+	for _, name := range c.CipherSuites {
+		id, ok := cipherSuite(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+	}
+
+	if c.ClientCAFile != "" {
+		content, err := ioutil.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("no certificate found in client_ca_file %s", c.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		// As in the exporter-toolkit, a client CA is only used for the
+		// client_auth_type given along with it.
+		if c.ClientAuthType == "" {
+			return nil, fmt.Errorf("client_ca_file requires client_auth_type")
+		}
+	}
+
+	if c.ClientAuthType != "" {
+		authType, ok := clientAuthTypes[c.ClientAuthType]
+		if !ok {
+			return nil, fmt.Errorf("unknown client_auth_type %q", c.ClientAuthType)
+		}
+		if tlsConfig.ClientCAs == nil && (authType == tls.VerifyClientCertIfGiven || authType == tls.RequireAndVerifyClientCert) {
+			return nil, fmt.Errorf("client_auth_type %s requires client_ca_file", c.ClientAuthType)
+		}
+		tlsConfig.ClientAuth = authType
+	}
+
+	return tlsConfig, nil
+}
+
+func cipherSuite(name string) (uint16, bool) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
+
+// dummyHash is compared with the passwords of unknown users, so that their
+// requests take as long as the ones of the known users.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+
+// handler requires the requests to next to authenticate as one of the basic
+// auth users, when there are some.
+func (config *webConfig) handler(next http.Handler) http.Handler {
+	if len(config.BasicAuthUsers) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if ok {
+			hash, known := config.BasicAuthUsers[user]
+			if !known {
+				hash = string(dummyHash)
+			}
+			err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+			if known && err == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("WWW-Authenticate", `Basic realm="OpenStack Exporter"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
+
+// listenAndServe serves handler on address, with the TLS and authentication
+// settings of config, if any.
+func listenAndServe(address string, handler http.Handler, config *webConfig) error {
+	server := &http.Server{Addr: address, Handler: handler}
+	if config == nil {
+		return server.ListenAndServe()
+	}
+	server.Handler = config.handler(handler)
+
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return err
+	}
+	if tlsConfig == nil {
+		log.Infoln("TLS is disabled")
+		return server.ListenAndServe()
+	}
+
+	server.TLSConfig = tlsConfig
+	if config.HTTPServerConfig.HTTP2 != nil && !*config.HTTPServerConfig.HTTP2 {
+		server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+	log.Infoln("TLS is enabled")
+	return server.ListenAndServeTLS("", "")
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1 and its key
+// to dir, as name.crt and name.key.
+func writeCertificate(t *testing.T, dir, name string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600))
+
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return cert
+}
+
+func TestWebConfigTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "web")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	serverCert := writeCertificate(t, dir, "server")
+	writeCertificate(t, dir, "client")
+	path := filepath.Join(dir, "web.yml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`
+tls_server_config:
+  cert_file: server.crt
+  key_file: server.key
+  client_ca_file: client.crt
+  client_auth_type: RequireAndVerifyClientCert
+  min_version: TLS12
+`), 0600))
+
+	config, err := loadWebConfig(path)
+	assert.NoError(t, err)
+	tlsConfig, err := config.tlsConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, tlsConfig.ClientAuth)
+
+	server := httptest.NewUnstartedServer(config.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	// httptest would replace the certificate of tlsConfig with its own.
+	server.Listener = tls.NewListener(server.Listener, tlsConfig)
+	server.Start()
+	defer server.Close()
+	url := strings.Replace(server.URL, "http://", "https://", 1)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	// The clients without a certificate signed by the client CA are refused.
+	_, err = client.Get(url)
+	assert.Error(t, err)
+
+	clientCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"))
+	assert.NoError(t, err)
+	client.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{clientCert}
+	response, err := client.Get(url)
+	if assert.NoError(t, err) {
+		response.Body.Close()
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	}
+}
+
+func TestWebConfigClientCAWithoutAuthType(t *testing.T) {
+	dir, err := ioutil.TempDir("", "web")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeCertificate(t, dir, "client")
+	path := filepath.Join(dir, "web.yml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("tls_server_config:\n  cert_file: client.crt\n  key_file: client.key\n  client_ca_file: client.crt\n"), 0600))
+
+	_, err = loadWebConfig(path)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "client_ca_file requires client_auth_type")
+	}
+}
+
+func TestWebConfigBasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	assert.NoError(t, err)
+	path := writeConfig(t, "basic_auth_users:\n  prometheus: "+string(hash)+"\n")
+	defer os.Remove(path)
+
+	config, err := loadWebConfig(path)
+	assert.NoError(t, err)
+	tlsConfig, err := config.tlsConfig()
+	assert.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+
+	handler := config.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, test := range []struct {
+		user, password string
+		code           int
+	}{
+		{"prometheus", "secret", http.StatusOK},
+		{"prometheus", "wrong", http.StatusUnauthorized},
+		{"unknown", "secret", http.StatusUnauthorized},
+		{"", "", http.StatusUnauthorized},
+	} {
+		request := httptest.NewRequest("GET", "/metrics", nil)
+		if test.user != "" {
+			request.SetBasicAuth(test.user, test.password)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		assert.Equal(t, test.code, recorder.Code, test.user+":"+test.password)
+	}
+}
+
+func TestInvalidWebConfig(t *testing.T) {
+	for _, content := range []string{
+		"unknown: true\n",
+		"basic_auth_users:\n  prometheus: secret\n",
+		"tls_server_config:\n  cert_file: server.crt\n",
+		"tls_server_config:\n  client_ca_file: ca.crt\n",
+		"tls_server_config:\n  cert_file: missing.crt\n  key_file: missing.key\n",
+	} {
+		path := writeConfig(t, content)
+		_, err := loadWebConfig(path)
+		assert.Error(t, err, content)
+		os.Remove(path)
+	}
+}